@@ -7,6 +7,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/config"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/kube"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
@@ -70,14 +71,18 @@ func NewGenerateCommand() *cobra.Command {
 				return err
 			}
 
-			err = cmdConfig.Backend.Login()
+			// Manifests often read the same states, fetch and parse each of them once per run
+			backend := backends.NewCache(cmdConfig.Backend)
+			err = backend.Login()
 			if err != nil {
 				return err
 			}
 
+			kube.Prefetch(manifests, backend, cmdConfig.PrefetchWorkers)
+
 			for _, manifest := range manifests {
 
-				template, err := kube.NewTemplate(manifest, cmdConfig.Backend)
+				template, err := kube.NewTemplate(manifest, backend)
 				if err != nil {
 					return err
 				}
@@ -0,0 +1,125 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+const (
+	azureStorageAPIVersion = "2020-10-02"
+)
+
+// AzureAuthorizer is an interface for the supported Azure Storage authentication methods
+type AzureAuthorizer interface {
+	Login() error
+	Authorize(req *http.Request) error
+}
+
+// AzureRMBackend is a struct for working with a Terraform azurerm State backend
+type AzureRMBackend struct {
+	stateDecoder
+
+	client    types.HTTPClient
+	endpoint  string
+	container string
+	auth      AzureAuthorizer
+	cache     *DiskCache
+}
+
+// AzureBlobEndpoint returns the blob service endpoint of a storage account
+func AzureBlobEndpoint(storageAccount string) string {
+	return fmt.Sprintf("https://%s.blob.core.windows.net", storageAccount)
+}
+
+// NewAzureRMBackend initializes a new Terraform azurerm State backend reading blobs
+// from `container` of the blob service at `endpoint`. `cache` may be nil to always download states.
+// Unlike other backends the cache isn't wrapped around `client`, as shared keys sign the If-None-Match header
+func NewAzureRMBackend(client types.HTTPClient, endpoint, container string, auth AzureAuthorizer, cache *DiskCache) *AzureRMBackend {
+	return &AzureRMBackend{
+		client:    client,
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		container: container,
+		auth:      auth,
+		cache:     cache,
+	}
+}
+
+// Login logs in with the configured authentication method
+func (a *AzureRMBackend) Login() error {
+	return a.auth.Login()
+}
+
+// GetSecrets gets secrets from terraform azurerm state backend and returns the formatted data
+func (a *AzureRMBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedVersion("azurerm", annotations); err != nil {
+		return nil, err
+	}
+
+	key := strings.TrimPrefix(path, "/")
+	// The terraform azurerm backend stores other workspaces at `<key>env:<workspace>`
+	if ws := selectedWorkspace(annotations); ws != DefaultWorkspace {
+		key += workspaceKeySuffix + ws
+	}
+	blobURL := fmt.Sprintf("%s/%s/%s", a.endpoint, a.container, key)
+
+	entry := a.cache.Get(blobURL)
+	if entry != nil && entry.Fresh {
+		utils.VerboseToStdErr("Terraform azurerm State using blob %s cached on disk", key)
+		return a.decode(path, entry.Data, annotations)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, blobURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("x-ms-version", azureStorageAPIVersion)
+	// Set before authorizing, shared keys sign the conditional headers
+	if entry != nil && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	err = a.auth.Authorize(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize request: %w", err)
+	}
+
+	utils.VerboseToStdErr("Terraform azurerm State getting blob %s from container %s", key, a.container)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("azure get blob: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		utils.VerboseToStdErr("Terraform azurerm State blob %s cached on disk is still current", key)
+		a.cache.Touch(blobURL)
+		return a.decode(path, entry.Data, annotations)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		utils.VerboseToStdErr("Terraform azurerm State unexpected response: %s", string(data))
+		return nil, fmt.Errorf("azure get blob %s: unexpected status %s", key, resp.Status)
+	}
+	a.cache.Put(blobURL, data, resp.Header.Get("ETag"))
+
+	return a.decode(path, data, annotations)
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the terraform azurerm state backend
+func (a *AzureRMBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := a.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
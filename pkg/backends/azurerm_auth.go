@@ -0,0 +1,248 @@
+package backends
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+const (
+	// AzureDefaultAuthorityHost is the Azure AD endpoint used for workload identity
+	AzureDefaultAuthorityHost = "https://login.microsoftonline.com"
+
+	azureStorageScope       = "https://storage.azure.com/.default"
+	azureClientAssertionJWT = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+)
+
+// AzureSharedKeyAuth authorizes requests with a storage account access key
+type AzureSharedKeyAuth struct {
+	account string
+	key     []byte
+}
+
+// NewAzureSharedKeyAuth initializes a new AzureSharedKeyAuth with the storage account name and its base64 encoded access key
+func NewAzureSharedKeyAuth(account, accessKey string) (*AzureSharedKeyAuth, error) {
+	key, err := base64.StdEncoding.DecodeString(accessKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode azure storage access key: %w", err)
+	}
+
+	return &AzureSharedKeyAuth{
+		account: account,
+		key:     key,
+	}, nil
+}
+
+// Login does nothing as every request is signed with the access key
+func (a *AzureSharedKeyAuth) Login() error {
+	return nil
+}
+
+// Authorize signs the request with the Shared Key scheme
+func (a *AzureSharedKeyAuth) Authorize(req *http.Request) error {
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(a.stringToSign(req)))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	req.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", a.account, signature))
+	return nil
+}
+
+// stringToSign builds the string to sign for the Blob service,
+// see https://learn.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key
+func (a *AzureSharedKeyAuth) stringToSign(req *http.Request) string {
+	contentLength := req.Header.Get("Content-Length")
+	if contentLength == "0" {
+		contentLength = ""
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-ms-") {
+			msHeaders = append(msHeaders, name)
+		}
+	}
+	sort.Strings(msHeaders)
+
+	var builder strings.Builder
+	for _, field := range []string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		req.Header.Get("Date"),
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+	} {
+		builder.WriteString(field)
+		builder.WriteString("\n")
+	}
+	for _, name := range msHeaders {
+		builder.WriteString(fmt.Sprintf("%s:%s\n", name, req.Header.Get(name)))
+	}
+
+	builder.WriteString(fmt.Sprintf("/%s%s", a.account, req.URL.EscapedPath()))
+	query := req.URL.Query()
+	var params []string
+	for name := range query {
+		params = append(params, name)
+	}
+	sort.Strings(params)
+	for _, name := range params {
+		values := query[name]
+		sort.Strings(values)
+		builder.WriteString(fmt.Sprintf("\n%s:%s", strings.ToLower(name), strings.Join(values, ",")))
+	}
+
+	return builder.String()
+}
+
+// AzureSASAuth authorizes requests with a shared access signature
+type AzureSASAuth struct {
+	query url.Values
+}
+
+// NewAzureSASAuth initializes a new AzureSASAuth with a SAS token, with or without the leading `?`
+func NewAzureSASAuth(sasToken string) (*AzureSASAuth, error) {
+	query, err := url.ParseQuery(strings.TrimPrefix(sasToken, "?"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse azure SAS token: %w", err)
+	}
+
+	return &AzureSASAuth{
+		query: query,
+	}, nil
+}
+
+// Login does nothing as the SAS token is added to every request
+func (a *AzureSASAuth) Login() error {
+	return nil
+}
+
+// Authorize adds the SAS token to the request query
+func (a *AzureSASAuth) Authorize(req *http.Request) error {
+	query := req.URL.Query()
+	for name, values := range a.query {
+		query[name] = values
+	}
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// AzureWorkloadIdentityAuth authorizes requests with an Azure AD token exchanged for a federated service account token
+type AzureWorkloadIdentityAuth struct {
+	client        types.HTTPClient
+	authorityHost string
+	tenantID      string
+	clientID      string
+	tokenFile     string
+
+	mutex   sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewAzureWorkloadIdentityAuth initializes a new AzureWorkloadIdentityAuth. The arguments match the
+// AZURE_AUTHORITY_HOST, AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_FEDERATED_TOKEN_FILE variables
+// injected by the Azure workload identity webhook
+func NewAzureWorkloadIdentityAuth(client types.HTTPClient, authorityHost, tenantID, clientID, tokenFile string) *AzureWorkloadIdentityAuth {
+	if authorityHost == "" {
+		authorityHost = AzureDefaultAuthorityHost
+	}
+
+	return &AzureWorkloadIdentityAuth{
+		client:        client,
+		authorityHost: strings.TrimSuffix(authorityHost, "/"),
+		tenantID:      tenantID,
+		clientID:      clientID,
+		tokenFile:     tokenFile,
+	}
+}
+
+// Login exchanges the federated token for an Azure AD access token
+func (a *AzureWorkloadIdentityAuth) Login() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.login()
+}
+
+func (a *AzureWorkloadIdentityAuth) login() error {
+	assertion, err := ioutil.ReadFile(a.tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read federated token: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {a.clientID},
+		"client_assertion_type": {azureClientAssertionJWT},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+		"scope":                 {azureStorageScope},
+	}
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/v2.0/token", a.authorityHost, a.tenantID)
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	utils.VerboseToStdErr("Azure workload identity requesting token for client %s from %s", a.clientID, tokenURL)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("azure token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return fmt.Errorf("failed to decode azure token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return fmt.Errorf("azure token request: unexpected status %s", resp.Status)
+	}
+
+	a.token = token.AccessToken
+	a.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return nil
+}
+
+// Authorize adds the access token to the request, logging in again if it expired
+func (a *AzureWorkloadIdentityAuth) Authorize(req *http.Request) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.token == "" || time.Now().After(a.expires.Add(-time.Minute)) {
+		err := a.login()
+		if err != nil {
+			return err
+		}
+	}
+
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
@@ -0,0 +1,134 @@
+package backends_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+)
+
+// Well-known Azurite development storage account
+const (
+	azuriteAccount = "devstoreaccount1"
+	azuriteKey     = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+func newAzuriteServer(t *testing.T, authorized func(r *http.Request) bool) *httptest.Server {
+	st := backends.TFState{
+		Version: backends.StateVersion,
+		Outputs: map[string]*backends.TFOutput{
+			"vnet_id": {Value: "vnet-1"},
+		},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-ms-version") == "" || !authorized(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/devstoreaccount1/tfstate/network.tfstate" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(st)
+	}))
+}
+
+func assertAzureState(t *testing.T, backend *backends.AzureRMBackend) {
+	if err := backend.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := backend.GetIndividualSecret("network.tfstate", "vnet_id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "vnet-1" {
+		t.Fatalf("vnet_id expected to be vnet-1 but received %v", val)
+	}
+
+	if _, err := backend.GetSecrets("missing.tfstate", nil); err == nil {
+		t.Fatal("expected an error for a missing blob")
+	}
+}
+
+func TestAzureRMState(t *testing.T) {
+	t.Run("AzureRM State with shared key", func(t *testing.T) {
+		key, _ := base64.StdEncoding.DecodeString(azuriteKey)
+		server := newAzuriteServer(t, func(r *http.Request) bool {
+			stringToSign := fmt.Sprintf("GET\n\n\n\n\n\n\n\n\n\n\n\nx-ms-date:%s\nx-ms-version:%s\n/%s%s",
+				r.Header.Get("x-ms-date"), r.Header.Get("x-ms-version"), azuriteAccount, r.URL.Path)
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(stringToSign))
+			expected := fmt.Sprintf("SharedKey %s:%s", azuriteAccount, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			return r.Header.Get("Authorization") == expected
+		})
+		defer server.Close()
+
+		auth, err := backends.NewAzureSharedKeyAuth(azuriteAccount, azuriteKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertAzureState(t, backends.NewAzureRMBackend(server.Client(), server.URL+"/"+azuriteAccount, "tfstate", auth, nil))
+
+		if _, err := backends.NewAzureSharedKeyAuth(azuriteAccount, "not base64"); err == nil {
+			t.Fatal("expected an error for an invalid access key")
+		}
+	})
+
+	t.Run("AzureRM State with SAS token", func(t *testing.T) {
+		server := newAzuriteServer(t, func(r *http.Request) bool {
+			return r.URL.Query().Get("sig") == "signature" && r.URL.Query().Get("sp") == "r"
+		})
+		defer server.Close()
+
+		auth, err := backends.NewAzureSASAuth("?sv=2020-10-02&sp=r&sig=signature")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertAzureState(t, backends.NewAzureRMBackend(server.Client(), server.URL+"/"+azuriteAccount, "tfstate", auth, nil))
+	})
+
+	t.Run("AzureRM State with workload identity", func(t *testing.T) {
+		tokenFile := filepath.Join(t.TempDir(), "token")
+		if err := ioutil.WriteFile(tokenFile, []byte("federated-token\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		authority := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			if r.URL.Path != "/tenant/oauth2/v2.0/token" ||
+				r.PostForm.Get("client_id") != "client" ||
+				r.PostForm.Get("client_assertion") != "federated-token" ||
+				!strings.HasPrefix(r.PostForm.Get("scope"), "https://storage.azure.com") {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{}`))
+				return
+			}
+			w.Write([]byte(`{"access_token": "aad-token", "expires_in": 3600}`))
+		}))
+		defer authority.Close()
+
+		server := newAzuriteServer(t, func(r *http.Request) bool {
+			return r.Header.Get("Authorization") == "Bearer aad-token"
+		})
+		defer server.Close()
+
+		auth := backends.NewAzureWorkloadIdentityAuth(authority.Client(), authority.URL, "tenant", "client", tokenFile)
+		assertAzureState(t, backends.NewAzureRMBackend(server.Client(), server.URL+"/"+azuriteAccount, "tfstate", auth, nil))
+
+		invalid := backends.NewAzureWorkloadIdentityAuth(authority.Client(), authority.URL, "tenant", "other-client", tokenFile)
+		if err := invalid.Login(); err == nil {
+			t.Fatal("expected an error for an unknown client")
+		}
+	})
+}
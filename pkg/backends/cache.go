@@ -0,0 +1,95 @@
+package backends
+
+import (
+	"sync"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+// Cache wraps a backend so every state is fetched and parsed once, no matter how many
+// manifests and placeholders read it. It's safe for concurrent use
+type Cache struct {
+	backend types.Backend
+
+	mutex  sync.Mutex
+	states map[cacheKey]*cachedState
+}
+
+// cacheKey identifies a state by its path and the annotations selecting which state is read and how it's checked.
+// The KV version selects how Vault secrets are read
+type cacheKey struct {
+	path      string
+	workspace string
+	version   string
+	lineage   string
+	minSerial string
+	kvVersion string
+}
+
+type cachedState struct {
+	done    chan struct{}
+	secrets map[string]interface{}
+	err     error
+}
+
+// NewCache initializes a new Cache in front of `backend`
+func NewCache(backend types.Backend) *Cache {
+	return &Cache{
+		backend: backend,
+		states:  map[cacheKey]*cachedState{},
+	}
+}
+
+// Serves tells whether the wrapped backend serves paths with `scheme`
+func (c *Cache) Serves(scheme string) bool {
+	router, ok := c.backend.(interface{ Serves(string) bool })
+	return ok && router.Serves(scheme)
+}
+
+// Login logs in the wrapped backend
+func (c *Cache) Login() error {
+	return c.backend.Login()
+}
+
+// GetSecrets gets secrets from the wrapped backend the first time the state is read, and
+// from the cache afterwards. Concurrent reads of the same state wait for a single fetch
+func (c *Cache) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	key := cacheKey{
+		path:      path,
+		workspace: selectedWorkspace(annotations),
+		version:   annotations[types.ATPVersionAnnotation],
+		lineage:   annotations[types.ATPLineageAnnotation],
+		minSerial: annotations[types.ATPMinSerialAnnotation],
+		kvVersion: annotations[types.ATPKVVersionAnnotation],
+	}
+
+	c.mutex.Lock()
+	state, ok := c.states[key]
+	if !ok {
+		state = &cachedState{done: make(chan struct{})}
+		c.states[key] = state
+	}
+	c.mutex.Unlock()
+
+	if ok {
+		<-state.done
+		utils.VerboseToStdErr("using cached state %s", path)
+		return state.secrets, state.err
+	}
+
+	state.secrets, state.err = c.backend.GetSecrets(path, annotations)
+	close(state.done)
+
+	return state.secrets, state.err
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the cached state
+func (c *Cache) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := c.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
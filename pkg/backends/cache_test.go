@@ -0,0 +1,125 @@
+package backends_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+)
+
+// countingBackend counts how often each state is read
+type countingBackend struct {
+	mutex sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingBackend) Login() error {
+	return nil
+}
+
+func (c *countingBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	id := fmt.Sprintf("%s@%s#%s", path, annotations[types.ATPWorkspaceAnnotation], annotations[types.ATPVersionAnnotation])
+	if kvVersion := annotations[types.ATPKVVersionAnnotation]; kvVersion != "" {
+		id += " kv" + kvVersion
+	}
+	c.reads[id]++
+	if path == "broken" {
+		return nil, fmt.Errorf("broken state")
+	}
+
+	return map[string]interface{}{
+		"id": id,
+	}, nil
+}
+
+func (c *countingBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	return nil, fmt.Errorf("the cache is expected to read whole states")
+}
+
+func TestCache(t *testing.T) {
+	counting := &countingBackend{reads: map[string]int{}}
+	cache := backends.NewCache(counting)
+
+	t.Run("reads each state once", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				val, err := cache.GetIndividualSecret("network", "id", nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if val != "network@#" {
+					t.Errorf("id expected to be network@# but received %v", val)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if counting.reads["network@#"] != 1 {
+			t.Fatalf("expected the state to be read once but it was read %d times", counting.reads["network@#"])
+		}
+	})
+
+	t.Run("keys states by workspace and version", func(t *testing.T) {
+		selections := []map[string]string{
+			{types.ATPWorkspaceAnnotation: "staging"},
+			{types.ATPVersionAnnotation: "v1"},
+			{types.ATPWorkspaceAnnotation: "staging", types.ATPVersionAnnotation: "v1"},
+		}
+		for _, annotations := range selections {
+			for i := 0; i < 2; i++ {
+				if _, err := cache.GetSecrets("network", annotations); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		for _, id := range []string{"network@staging#", "network@#v1", "network@staging#v1"} {
+			if counting.reads[id] != 1 {
+				t.Fatalf("expected %s to be read once but it was read %d times", id, counting.reads[id])
+			}
+		}
+	})
+
+	t.Run("keys secrets by KV version", func(t *testing.T) {
+		for _, kvVersion := range []string{"1", "2", "1"} {
+			val, err := cache.GetIndividualSecret("vault://secret/data/database", "id", map[string]string{types.ATPKVVersionAnnotation: kvVersion})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := "vault://secret/data/database@# kv" + kvVersion
+			if val != expected {
+				t.Fatalf("id expected to be %s but received %v", expected, val)
+			}
+		}
+
+		for _, id := range []string{"vault://secret/data/database@# kv1", "vault://secret/data/database@# kv2"} {
+			if counting.reads[id] != 1 {
+				t.Fatalf("expected %s to be read once but it was read %d times", id, counting.reads[id])
+			}
+		}
+	})
+
+	t.Run("keeps failures", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if _, err := cache.GetSecrets("broken", nil); err == nil {
+				t.Fatal("expected an error for a broken state")
+			}
+		}
+		if counting.reads["broken@#"] != 1 {
+			t.Fatalf("expected the state to be read once but it was read %d times", counting.reads["broken@#"])
+		}
+
+		if _, err := cache.GetIndividualSecret("network", "missing", nil); err == nil {
+			t.Fatal("expected an error for a missing output")
+		}
+	})
+}
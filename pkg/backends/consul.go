@@ -0,0 +1,158 @@
+package backends
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+const (
+	// ConsulDefaultAddress is the address of the local Consul agent
+	ConsulDefaultAddress = "http://127.0.0.1:8500"
+)
+
+// ConsulBackend is a struct for working with a Terraform Consul State backend
+type ConsulBackend struct {
+	stateDecoder
+
+	client     types.HTTPClient
+	address    string
+	token      string
+	datacenter string
+}
+
+// consulChunkHeader is stored at the state path instead of the state when
+// terraform splits a large state into several KV entries
+type consulChunkHeader struct {
+	Hash   string   `json:"current-hash"`
+	Chunks []string `json:"chunks"`
+}
+
+// NewConsulBackend initializes a new Terraform Consul State backend
+func NewConsulBackend(client types.HTTPClient, address, token, datacenter string) *ConsulBackend {
+	return &ConsulBackend{
+		client:     client,
+		address:    strings.TrimSuffix(address, "/"),
+		token:      token,
+		datacenter: datacenter,
+	}
+}
+
+// Login does nothing as the ACL token is sent with every request
+func (c *ConsulBackend) Login() error {
+	return nil
+}
+
+// GetSecrets gets secrets from terraform Consul state backend and returns the formatted data
+func (c *ConsulBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedVersion("consul", annotations); err != nil {
+		return nil, err
+	}
+
+	path = strings.Trim(path, "/")
+	// The terraform consul backend stores other workspaces at `<path>-env:<workspace>`
+	if ws := selectedWorkspace(annotations); ws != DefaultWorkspace {
+		path += "-" + workspaceKeySuffix + ws
+	}
+
+	utils.VerboseToStdErr("Terraform Consul State getting key %s", path)
+	payload, err := c.getKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var header consulChunkHeader
+	if json.Unmarshal(payload, &header) == nil && header.Hash != "" {
+		utils.VerboseToStdErr("Terraform Consul State reading %d chunks of %s", len(header.Chunks), path)
+		payload = nil
+		for _, chunk := range header.Chunks {
+			data, err := c.getKey(chunk)
+			if err != nil {
+				return nil, err
+			}
+			payload = append(payload, data...)
+		}
+	}
+
+	// Terraform gzips the state when `gzip = true`, gzip data starts with 0x1f
+	if len(payload) > 0 && payload[0] == '\x1f' {
+		payload, err = gunzip(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress state: %w", err)
+		}
+	}
+
+	if header.Hash != "" && fmt.Sprintf("%x", md5.Sum(payload)) != header.Hash {
+		return nil, fmt.Errorf("state at %s does not match the expected hash %s", path, header.Hash)
+	}
+
+	return c.decode(path, payload, annotations)
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the terraform Consul state backend
+func (c *ConsulBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := c.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+func (c *ConsulBackend) getKey(key string) ([]byte, error) {
+	query := url.Values{"raw": {""}}
+	if c.datacenter != "" {
+		query.Set("dc", c.datacenter)
+	}
+	// Escape each segment, keys may hold spaces, `?` or `%`
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	keyURL := fmt.Sprintf("%s/v1/kv/%s?%s", c.address, strings.Join(segments, "/"), query.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, keyURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("consul get key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		utils.VerboseToStdErr("Terraform Consul State unexpected response: %s", string(data))
+		return nil, fmt.Errorf("consul get key %s: unexpected status %s", key, resp.Status)
+	}
+
+	return data, nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
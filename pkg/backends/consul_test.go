@@ -0,0 +1,120 @@
+package backends_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+)
+
+func gzipData(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestConsulState(t *testing.T) {
+	stateJson, err := json.Marshal(backends.TFState{
+		Version: backends.StateVersion,
+		Outputs: map[string]*backends.TFOutput{
+			"subnet": {Value: "10.0.0.0/24"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv := map[string][]byte{
+		"tf/plain": stateJson,
+		"tf/gzip":  gzipData(t, stateJson),
+		// Escaped in the request URL
+		"tf/my app?env=prod/100%": stateJson,
+	}
+
+	// Chunked layout: the state path holds a header pointing to the gzipped chunks
+	compressed := gzipData(t, stateJson)
+	hash := fmt.Sprintf("%x", md5.Sum(stateJson))
+	half := len(compressed) / 2
+	kv[fmt.Sprintf("tf/chunked/tfstate.%s/0", hash)] = compressed[:half]
+	kv[fmt.Sprintf("tf/chunked/tfstate.%s/1", hash)] = compressed[half:]
+	kv["tf/chunked"], _ = json.Marshal(map[string]interface{}{
+		"current-hash": hash,
+		"chunks": []string{
+			fmt.Sprintf("tf/chunked/tfstate.%s/0", hash),
+			fmt.Sprintf("tf/chunked/tfstate.%s/1", hash),
+		},
+	})
+	kv["tf/corrupted"], _ = json.Marshal(map[string]interface{}{
+		"current-hash": "0000",
+		"chunks":       []string{"tf/plain"},
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "acl-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if _, raw := r.URL.Query()["raw"]; !raw || r.URL.Query().Get("dc") != "dc1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		value, ok := kv[strings.TrimPrefix(r.URL.Path, "/v1/kv/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(value)
+	}))
+	defer server.Close()
+
+	backend := backends.NewConsulBackend(server.Client(), server.URL, "acl-token", "dc1")
+
+	t.Run("Consul State GetSecrets()", func(t *testing.T) {
+		for _, path := range []string{"tf/plain", "tf/gzip", "/tf/chunked", "tf/my app?env=prod/100%"} {
+			secrets, err := backend.GetSecrets(path, nil)
+			if err != nil {
+				t.Fatalf("%s: %s", path, err)
+			}
+			if secrets["subnet"] != "10.0.0.0/24" {
+				t.Fatalf("subnet from %s expected to be 10.0.0.0/24 but received %v", path, secrets["subnet"])
+			}
+		}
+	})
+
+	t.Run("Consul State GetIndividualSecret()", func(t *testing.T) {
+		val, err := backend.GetIndividualSecret("tf/chunked", "subnet", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "10.0.0.0/24" {
+			t.Fatalf("subnet expected to be 10.0.0.0/24 but received %v", val)
+		}
+	})
+
+	t.Run("Consul State errors", func(t *testing.T) {
+		if _, err := backend.GetSecrets("tf/corrupted", nil); err == nil {
+			t.Fatal("expected an error for a hash mismatch")
+		}
+		if _, err := backend.GetSecrets("tf/missing", nil); err == nil {
+			t.Fatal("expected an error for a missing key")
+		}
+
+		unauthorized := backends.NewConsulBackend(server.Client(), server.URL, "", "dc1")
+		if _, err := unauthorized.GetSecrets("tf/plain", nil); err == nil {
+			t.Fatal("expected an error without ACL token")
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package backends
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+// DiskCache keeps downloaded states on disk between runs. Entries younger than the TTL are used as they are,
+// older entries are revalidated with their ETag. A nil *DiskCache caches nothing
+type DiskCache struct {
+	dir   string
+	ttl   time.Duration
+	scope string
+}
+
+// DiskCacheEntry is a state stored by a DiskCache
+type DiskCacheEntry struct {
+	ETag string `json:"etag"`
+	Data []byte `json:"data"`
+
+	// Fresh tells whether the entry is younger than the TTL and can be used without revalidation
+	Fresh bool `json:"-"`
+}
+
+// NewDiskCache initializes a new DiskCache storing entries in `dir`
+func NewDiskCache(dir string, ttl time.Duration) *DiskCache {
+	return &DiskCache{
+		dir: dir,
+		ttl: ttl,
+	}
+}
+
+// Scoped returns a cache sharing the directory of `d` whose entries are only visible to caches scoped to the same
+// `identity`, e.g. the server and credentials states are read with. Runs with other credentials would otherwise be
+// served fresh entries without the server ever checking their credentials
+func (d *DiskCache) Scoped(identity ...string) *DiskCache {
+	if d == nil {
+		return nil
+	}
+
+	return &DiskCache{
+		dir:   d.dir,
+		ttl:   d.ttl,
+		scope: fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(identity, "\x00")))),
+	}
+}
+
+// Get returns the entry stored for `key`, or nil if there's none
+func (d *DiskCache) Get(key string) *DiskCacheEntry {
+	if d == nil {
+		return nil
+	}
+
+	path := d.path(key)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		utils.VerboseToStdErr("failed to read cached state %s: %s", key, err)
+		return nil
+	}
+
+	var entry DiskCacheEntry
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		utils.VerboseToStdErr("ignoring corrupt cached state %s: %s", key, err)
+		return nil
+	}
+	entry.Fresh = time.Since(info.ModTime()) < d.ttl
+
+	return &entry
+}
+
+// Put stores `data` with its `etag` for `key`. The cache is best effort, so failures are only logged
+func (d *DiskCache) Put(key string, data []byte, etag string) {
+	if d == nil {
+		return
+	}
+
+	entry, err := json.Marshal(DiskCacheEntry{
+		ETag: etag,
+		Data: data,
+	})
+	if err == nil {
+		err = d.write(key, entry)
+	}
+	if err != nil {
+		utils.VerboseToStdErr("failed to cache state %s: %s", key, err)
+	}
+}
+
+// Touch marks the entry for `key` as fresh again after it was revalidated
+func (d *DiskCache) Touch(key string) {
+	if d == nil {
+		return
+	}
+
+	now := time.Now()
+	err := os.Chtimes(d.path(key), now, now)
+	if err != nil {
+		utils.VerboseToStdErr("failed to touch cached state %s: %s", key, err)
+	}
+}
+
+// write replaces the entry atomically, as concurrent runs may share the directory.
+// States hold secrets, so entries are only readable by the owner
+func (d *DiskCache) write(key string, entry []byte) error {
+	err := os.MkdirAll(d.dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(d.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(entry)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), d.path(key))
+}
+
+func (d *DiskCache) path(key string) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(d.scope+"\x00"+key))))
+}
+
+type diskCachingClient struct {
+	client types.HTTPClient
+	cache  *DiskCache
+}
+
+// NewDiskCachingClient wraps `client` so GET responses are kept in `cache` and revalidated with
+// If-None-Match. Without a cache `client` is returned as it is
+func NewDiskCachingClient(client types.HTTPClient, cache *DiskCache) types.HTTPClient {
+	if cache == nil {
+		return client
+	}
+
+	return &diskCachingClient{
+		client: client,
+		cache:  cache,
+	}
+}
+
+// Do sends the request unless a fresh response is cached. Cached responses are returned as `200 OK`
+func (c *diskCachingClient) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return c.client.Do(req)
+	}
+
+	key := req.URL.String()
+	entry := c.cache.Get(key)
+	if entry != nil && entry.Fresh {
+		utils.VerboseToStdErr("using state %s cached on disk", key)
+		return cachedResponse(req, entry), nil
+	}
+	if entry != nil && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && entry != nil:
+		resp.Body.Close()
+		utils.VerboseToStdErr("state %s cached on disk is still current", key)
+		c.cache.Touch(key)
+		return cachedResponse(req, entry), nil
+	case resp.StatusCode == http.StatusOK:
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read: %w", err)
+		}
+		c.cache.Put(key, data, resp.Header.Get("ETag"))
+		resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+
+	return resp, nil
+}
+
+func cachedResponse(req *http.Request, entry *DiskCacheEntry) *http.Response {
+	header := http.Header{}
+	if entry.ETag != "" {
+		header.Set("ETag", entry.ETag)
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Data)),
+		ContentLength: int64(len(entry.Data)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,262 @@
+package backends_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/minio/minio-go/v7"
+)
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := backends.NewDiskCache(dir, time.Hour)
+
+	if entry := cache.Get("state"); entry != nil {
+		t.Fatalf("expected no entry but got %v", entry)
+	}
+
+	cache.Put("state", []byte("data"), `"etag"`)
+	entry := cache.Get("state")
+	if entry == nil || string(entry.Data) != "data" || entry.ETag != `"etag"` || !entry.Fresh {
+		t.Fatalf("expected a fresh entry but got %v", entry)
+	}
+
+	stale := backends.NewDiskCache(dir, 0)
+	if entry := stale.Get("state"); entry == nil || entry.Fresh {
+		t.Fatalf("expected a stale entry but got %v", entry)
+	}
+
+	var disabled *backends.DiskCache
+	disabled.Put("state", []byte("data"), "")
+	disabled.Touch("state")
+	if entry := disabled.Get("state"); entry != nil {
+		t.Fatalf("expected a nil cache to cache nothing but got %v", entry)
+	}
+}
+
+func TestDiskCachingClient(t *testing.T) {
+	requests, downloads := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		fmt.Fprint(w, `{"version": 4, "outputs": {"vpc_id": {"value": "vpc-123"}}}`)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	for _, ttl := range []time.Duration{0, time.Hour} {
+		client := backends.NewDiskCachingClient(server.Client(), backends.NewDiskCache(dir, ttl))
+		backend := backends.NewHTTPBackend(client, server.URL, "", "", nil)
+		for i := 0; i < 2; i++ {
+			val, err := backend.GetIndividualSecret("network", "vpc_id", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val != "vpc-123" {
+				t.Fatalf("vpc_id expected to be vpc-123 but received %v", val)
+			}
+		}
+	}
+
+	// Without TTL the state is downloaded once and revalidated afterwards,
+	// the revalidation makes it fresh for the cache with TTL
+	if downloads != 1 || requests != 2 {
+		t.Fatalf("expected 1 download and 2 requests but got %d downloads and %d requests", downloads, requests)
+	}
+
+	if backends.NewDiskCachingClient(server.Client(), nil) != server.Client() {
+		t.Fatal("expected the client to be returned as it is without a cache")
+	}
+}
+
+func TestDiskCachingClientScoped(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if user, password, _ := r.BasicAuth(); user != "ci" || password != "token-a" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"version": 4, "outputs": {"vpc_id": {"value": "vpc-123"}}}`)
+	}))
+	defer server.Close()
+
+	cache := backends.NewDiskCache(t.TempDir(), time.Hour)
+	newBackend := func(password string) *backends.HTTPBackend {
+		client := backends.NewDiskCachingClient(server.Client(), cache.Scoped("ci", password))
+		return backends.NewHTTPBackend(client, server.URL, "ci", password, nil)
+	}
+
+	if _, err := newBackend("token-a").GetSecrets("network", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newBackend("token-a").GetSecrets("network", nil); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Fatalf("expected the state to be cached for the same credentials but got %d requests", requests)
+	}
+
+	// The fresh entry of the first credentials must not be served without checking the second ones
+	if _, err := newBackend("token-b").GetSecrets("network", nil); err == nil {
+		t.Fatal("expected the cached state not to be served for other credentials")
+	}
+	if requests != 2 {
+		t.Fatalf("expected a request for other credentials but got %d requests", requests)
+	}
+}
+
+// etagMinioClient serves a single object, honouring If-None-Match like S3
+type etagMinioClient struct {
+	data      []byte
+	etag      string
+	requests  int
+	downloads int
+}
+
+type etagMinioObject struct {
+	io.Reader
+	info minio.ObjectInfo
+	err  error
+}
+
+func (o *etagMinioObject) Stat() (minio.ObjectInfo, error) {
+	return o.info, o.err
+}
+
+func (m *etagMinioClient) GetObject(_ context.Context, _, _ string, opt minio.GetObjectOptions) (io.Reader, error) {
+	m.requests++
+	if opt.Header().Get("If-None-Match") == `"`+m.etag+`"` {
+		return &etagMinioObject{
+			Reader: bytes.NewReader(nil),
+			err:    minio.ErrorResponse{StatusCode: http.StatusNotModified},
+		}, nil
+	}
+
+	m.downloads++
+	return &etagMinioObject{
+		Reader: bytes.NewReader(m.data),
+		info:   minio.ObjectInfo{ETag: m.etag},
+	}, nil
+}
+
+func TestS3DiskCache(t *testing.T) {
+	data, err := json.Marshal(backends.TFState{
+		Version: backends.StateVersion,
+		Outputs: map[string]*backends.TFOutput{
+			"vpc_id": {Value: "vpc-123"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &etagMinioClient{data: data, etag: "v1"}
+	dir := t.TempDir()
+
+	for _, ttl := range []time.Duration{0, time.Hour} {
+		backend := backends.NewS3Backend(mock, "tf-states", "", backends.NewDiskCache(dir, ttl), nil)
+		for i := 0; i < 2; i++ {
+			val, err := backend.GetIndividualSecret("network.tfstate", "vpc_id", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val != "vpc-123" {
+				t.Fatalf("vpc_id expected to be vpc-123 but received %v", val)
+			}
+		}
+	}
+	if mock.downloads != 1 || mock.requests != 2 {
+		t.Fatalf("expected 1 download and 2 requests but got %d downloads and %d requests", mock.downloads, mock.requests)
+	}
+
+	t.Run("versions are never revalidated", func(t *testing.T) {
+		backend := backends.NewS3Backend(mock, "tf-states", "", backends.NewDiskCache(dir, 0), nil)
+		annotations := map[string]string{types.ATPVersionAnnotation: "v1"}
+		for i := 0; i < 2; i++ {
+			if _, err := backend.GetSecrets("network.tfstate", annotations); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if mock.requests != 3 {
+			t.Fatalf("expected a single request for the version but got %d", mock.requests-2)
+		}
+	})
+
+	t.Run("entries are private", func(t *testing.T) {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			if file.Mode().Perm()&0077 != 0 {
+				t.Fatalf("expected %s to be private but its mode is %s", file.Name(), file.Mode())
+			}
+		}
+	})
+}
+
+func TestAzureRMDiskCache(t *testing.T) {
+	requests, downloads := 0, 0
+	key, _ := base64.StdEncoding.DecodeString(azuriteKey)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// The signature covers If-None-Match, so it must be set before the request is signed
+		stringToSign := fmt.Sprintf("GET\n\n\n\n\n\n\n\n\n%s\n\n\nx-ms-date:%s\nx-ms-version:%s\n/%s%s",
+			r.Header.Get("If-None-Match"), r.Header.Get("x-ms-date"), r.Header.Get("x-ms-version"), azuriteAccount, r.URL.Path)
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(stringToSign))
+		if r.Header.Get("Authorization") != fmt.Sprintf("SharedKey %s:%s", azuriteAccount, base64.StdEncoding.EncodeToString(mac.Sum(nil))) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		fmt.Fprint(w, `{"version": 4, "outputs": {"vnet_id": {"value": "vnet-1"}}}`)
+	}))
+	defer server.Close()
+
+	auth, err := backends.NewAzureSharedKeyAuth(azuriteAccount, azuriteKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, ttl := range []time.Duration{0, time.Hour} {
+		backend := backends.NewAzureRMBackend(server.Client(), server.URL+"/"+azuriteAccount, "tfstate", auth, backends.NewDiskCache(dir, ttl))
+		for i := 0; i < 2; i++ {
+			val, err := backend.GetIndividualSecret("network.tfstate", "vnet_id", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val != "vnet-1" {
+				t.Fatalf("vnet_id expected to be vnet-1 but received %v", val)
+			}
+		}
+	}
+
+	// Like the http client, the state is downloaded once and revalidated once
+	if downloads != 1 || requests != 2 {
+		t.Fatalf("expected 1 download and 2 requests but got %d downloads and %d requests", downloads, requests)
+	}
+}
@@ -0,0 +1,190 @@
+package backends
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// openTofuEncryptionVersion is the version of the envelope OpenTofu writes encrypted states in
+	openTofuEncryptionVersion = "v0"
+	// pbkdf2MetaPrefix prefixes the metadata keys of OpenTofu's pbkdf2 key providers, followed by the provider name
+	pbkdf2MetaPrefix = "key_provider.pbkdf2."
+)
+
+// StateEncryption decrypts states encrypted by OpenTofu with the aes_gcm method, keyed either by a pbkdf2
+// passphrase or by a static key. A nil *StateEncryption decrypts nothing
+type StateEncryption struct {
+	passphrase string
+	key        []byte
+}
+
+// encryptedState is the envelope of a state encrypted by OpenTofu
+type encryptedState struct {
+	Meta    map[string]json.RawMessage `json:"meta"`
+	Data    []byte                     `json:"encrypted_data"`
+	Version string                     `json:"encryption_version"`
+}
+
+// pbkdf2Meta are the parameters a pbkdf2 key provider derived the key of a state with
+type pbkdf2Meta struct {
+	Salt         []byte `json:"salt"`
+	Iterations   int    `json:"iterations"`
+	HashFunction string `json:"hash_function"`
+	KeyLength    int    `json:"key_length"`
+}
+
+// NewStateEncryption initializes a new StateEncryption with a pbkdf2 `passphrase` or a static AES `key`
+func NewStateEncryption(passphrase string, key []byte) (*StateEncryption, error) {
+	if passphrase == "" && len(key) == 0 {
+		return nil, fmt.Errorf("a passphrase or a key is required for state encryption")
+	}
+	if len(key) != 0 {
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("invalid state encryption key: %w", err)
+		}
+	}
+
+	return &StateEncryption{
+		passphrase: passphrase,
+		key:        key,
+	}, nil
+}
+
+// Decrypt returns the plain state of `data`. States which aren't encrypted are returned as they are,
+// so states can be read while they are migrated to encryption
+func (e *StateEncryption) Decrypt(data []byte) ([]byte, error) {
+	// Avoids decoding every plain state twice
+	if !bytes.Contains(data, []byte(`"encrypted_data"`)) {
+		return data, nil
+	}
+
+	var state encryptedState
+	err := json.Unmarshal(data, &state)
+	if err != nil || state.Version == "" {
+		return data, nil
+	}
+	if state.Version != openTofuEncryptionVersion {
+		return nil, fmt.Errorf("unsupported encryption version %s, only version %s is supported", state.Version, openTofuEncryptionVersion)
+	}
+	if e == nil {
+		return nil, fmt.Errorf("the state is encrypted, but no state encryption passphrase or key is configured")
+	}
+
+	keys, err := e.keys(state.Meta)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		plain, err := openAESGCM(key, state.Data)
+		if err == nil {
+			return plain, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to decrypt state, the passphrase or key does not match")
+}
+
+// keys returns the candidate keys of a state. Passphrases are derived with the parameters of every
+// pbkdf2 key provider in `meta`, as a state may be encrypted with a fallback provider
+func (e *StateEncryption) keys(meta map[string]json.RawMessage) ([][]byte, error) {
+	var keys [][]byte
+	if len(e.key) != 0 {
+		keys = append(keys, e.key)
+	}
+	if e.passphrase == "" {
+		return keys, nil
+	}
+
+	for name, raw := range meta {
+		if !strings.HasPrefix(name, pbkdf2MetaPrefix) {
+			continue
+		}
+
+		params, err := decodePBKDF2Meta(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s metadata: %w", name, err)
+		}
+		var hashFunction func() hash.Hash
+		switch params.HashFunction {
+		case "sha256":
+			hashFunction = sha256.New
+		case "sha512":
+			hashFunction = sha512.New
+		default:
+			return nil, fmt.Errorf("unsupported %s hash function %s", name, params.HashFunction)
+		}
+
+		keys = append(keys, pbkdf2.Key([]byte(e.passphrase), params.Salt, params.Iterations, params.KeyLength, hashFunction))
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("the state was not encrypted with a pbkdf2 passphrase")
+	}
+
+	return keys, nil
+}
+
+// decodePBKDF2Meta decodes metadata stored base64 encoded, as OpenTofu writes it, or as plain JSON
+func decodePBKDF2Meta(raw json.RawMessage) (*pbkdf2Meta, error) {
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		raw, err = base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var params pbkdf2Meta
+	err := json.Unmarshal(raw, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &params, nil
+}
+
+// openAESGCM decrypts `data`, which starts with the nonce like OpenTofu's aes_gcm method writes it
+func openAESGCM(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted data too short")
+	}
+
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// stateDecoder decodes the raw states read by a backend, decrypting them first when they are encrypted
+type stateDecoder struct {
+	encryption *StateEncryption
+}
+
+// SetStateEncryption sets how encrypted states are decrypted
+func (d *stateDecoder) SetStateEncryption(encryption *StateEncryption) {
+	d.encryption = encryption
+}
+
+func (d *stateDecoder) decode(path string, data []byte, annotations map[string]string) (map[string]interface{}, error) {
+	data, err := d.encryption.Decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("state at %s: %w", path, err)
+	}
+
+	return parseState(path, data, annotations)
+}
@@ -0,0 +1,136 @@
+package backends_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const plainState = `{"version": 4, "outputs": {"vpc_id": {"value": "vpc-123"}}}`
+
+// encryptState encrypts `state` with `key` like OpenTofu's aes_gcm method and wraps it in its envelope
+func encryptState(t *testing.T, state string, key []byte, meta map[string][]byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"meta":               meta,
+		"encrypted_data":     gcm.Seal(nonce, nonce, []byte(state), nil),
+		"encryption_version": "v0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// passphraseState encrypts `state` with a key derived from `passphrase` like OpenTofu's pbkdf2 key provider
+func passphraseState(t *testing.T, state, passphrase string) []byte {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := json.Marshal(map[string]interface{}{
+		"salt":          salt,
+		"iterations":    1000,
+		"hash_function": "sha512",
+		"key_length":    32,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := pbkdf2.Key([]byte(passphrase), salt, 1000, 32, sha512.New)
+	return encryptState(t, state, key, map[string][]byte{"key_provider.pbkdf2.main": meta})
+}
+
+func TestStateEncryption(t *testing.T) {
+	staticKey := []byte("0123456789abcdef0123456789abcdef")
+	root := t.TempDir()
+	states := map[string][]byte{
+		"plain":      []byte(plainState),
+		"passphrase": passphraseState(t, plainState, "correct horse battery staple"),
+		"static":     encryptState(t, plainState, staticKey, nil),
+	}
+	for name, data := range states {
+		if err := ioutil.WriteFile(filepath.Join(root, name+".tfstate"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	passphrase, err := backends.NewStateEncryption("correct horse battery staple", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongPassphrase, err := backends.NewStateEncryption("wrong", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	static, err := backends.NewStateEncryption("", staticKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name       string
+		encryption *backends.StateEncryption
+		path       string
+		valid      bool
+	}{
+		{"plain state without encryption", nil, "plain.tfstate", true},
+		{"plain state with encryption", passphrase, "plain.tfstate", true},
+		{"passphrase", passphrase, "passphrase.tfstate", true},
+		{"wrong passphrase", wrongPassphrase, "passphrase.tfstate", false},
+		{"static key", static, "static.tfstate", true},
+		{"static key for a passphrase state", static, "passphrase.tfstate", false},
+		{"encrypted state without encryption", nil, "static.tfstate", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := backends.NewLocalBackend(root)
+			backend.SetStateEncryption(tc.encryption)
+
+			val, err := backend.GetIndividualSecret(tc.path, "vpc_id", nil)
+			if !tc.valid {
+				if err == nil {
+					t.Fatal("expected the state to fail decryption")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val != "vpc-123" {
+				t.Fatalf("vpc_id expected to be vpc-123 but received %v", val)
+			}
+		})
+	}
+
+	t.Run("invalid keys are rejected", func(t *testing.T) {
+		if _, err := backends.NewStateEncryption("", []byte("short")); err == nil {
+			t.Fatal("expected an error for a key of invalid length")
+		}
+		if _, err := backends.NewStateEncryption("", nil); err == nil {
+			t.Fatal("expected an error without passphrase and key")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+const (
+	// GCSDefaultEndpoint is the Google Cloud Storage JSON API endpoint
+	GCSDefaultEndpoint = "https://storage.googleapis.com"
+	// GCSReadOnlyScope is the OAuth2 scope needed to read state objects
+	GCSReadOnlyScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+	gcsStateSuffix = ".tfstate"
+)
+
+// GCSBackend is a struct for working with a Terraform GCS State backend
+type GCSBackend struct {
+	stateDecoder
+
+	client   types.HTTPClient
+	endpoint string
+	bucket   string
+}
+
+// NewGCSBackend initializes a new Terraform GCS State backend. `client` is expected
+// to authenticate the requests, e.g. an oauth2 client for a service account
+func NewGCSBackend(client types.HTTPClient, endpoint, bucket string) *GCSBackend {
+	return &GCSBackend{
+		client:   client,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		bucket:   bucket,
+	}
+}
+
+// Login does nothing as a "login" is handled by the authenticated http client
+func (g *GCSBackend) Login() error {
+	return nil
+}
+
+// GetSecrets gets secrets from terraform GCS state backend and returns the formatted data
+func (g *GCSBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedVersion("gcs", annotations); err != nil {
+		return nil, err
+	}
+
+	object := gcsStateObject(path, selectedWorkspace(annotations))
+	objectURL := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", g.endpoint, url.PathEscape(g.bucket), url.PathEscape(object))
+
+	req, err := http.NewRequest(http.MethodGet, objectURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	utils.VerboseToStdErr("Terraform GCS State getting object %s from bucket %s", object, g.bucket)
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gcs get object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		utils.VerboseToStdErr("Terraform GCS State unexpected response: %s", string(data))
+		return nil, fmt.Errorf("gcs get object %s: unexpected status %s", object, resp.Status)
+	}
+
+	return g.decode(path, data, annotations)
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the terraform GCS state backend
+func (g *GCSBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := g.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+// gcsStateObject maps a path to the object name the terraform gcs backend uses.
+// A path is the backend `prefix` and resolves to `<prefix>/<workspace>.tfstate`,
+// unless it already names a `.tfstate` object
+func gcsStateObject(path, workspace string) string {
+	path = strings.Trim(path, "/")
+	if strings.HasSuffix(path, gcsStateSuffix) {
+		return path
+	}
+	if path == "" {
+		return workspace + gcsStateSuffix
+	}
+
+	return path + "/" + workspace + gcsStateSuffix
+}
@@ -0,0 +1,83 @@
+package backends_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+)
+
+func TestGCSState(t *testing.T) {
+	objects := map[string]backends.TFState{
+		"/storage/v1/b/tf-states/o/network/default.tfstate": {
+			Version: backends.StateVersion,
+			Outputs: map[string]*backends.TFOutput{
+				"vpc_id": {Value: "vpc-default"},
+			},
+		},
+		"/storage/v1/b/tf-states/o/network/staging.tfstate": {
+			Version: backends.StateVersion,
+			Outputs: map[string]*backends.TFOutput{
+				"vpc_id": {Value: "vpc-staging"},
+			},
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st, ok := objects[r.URL.Path]
+		if !ok || r.URL.Query().Get("alt") != "media" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(st)
+	}))
+	defer server.Close()
+
+	backend := backends.NewGCSBackend(server.Client(), server.URL+"/", "tf-states")
+
+	t.Run("GCS State GetSecrets()", func(t *testing.T) {
+		testCases := map[string]string{
+			"network":                 "vpc-default",
+			"/network/":               "vpc-default",
+			"network/staging.tfstate": "vpc-staging",
+		}
+		for path, expected := range testCases {
+			secrets, err := backend.GetSecrets(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets["vpc_id"] != expected {
+				t.Fatalf("vpc_id from %s expected to be %v but received %v", path, expected, secrets["vpc_id"])
+			}
+		}
+	})
+
+	t.Run("GCS State GetIndividualSecret()", func(t *testing.T) {
+		val, err := backend.GetIndividualSecret("network", "vpc_id", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "vpc-default" {
+			t.Fatalf("vpc_id expected to be vpc-default but received %v", val)
+		}
+	})
+
+	t.Run("GCS State workspaces", func(t *testing.T) {
+		val, err := backend.GetIndividualSecret("network", "vpc_id", map[string]string{types.ATPWorkspaceAnnotation: "staging"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "vpc-staging" {
+			t.Fatalf("vpc_id expected to be vpc-staging but received %v", val)
+		}
+	})
+
+	t.Run("GCS State missing object", func(t *testing.T) {
+		if _, err := backend.GetSecrets("missing", nil); err == nil {
+			t.Fatal("expected an error for a missing object")
+		}
+	})
+}
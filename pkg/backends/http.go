@@ -0,0 +1,104 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+// HTTPBackend is a struct for working with a Terraform HTTP State backend
+type HTTPBackend struct {
+	stateDecoder
+
+	client   types.HTTPClient
+	address  string
+	username string
+	password string
+	headers  map[string]string
+}
+
+// NewHTTPBackend initializes a new Terraform HTTP State backend.
+// State paths are resolved relative to `address`
+func NewHTTPBackend(client types.HTTPClient, address, username, password string, headers map[string]string) *HTTPBackend {
+	return &HTTPBackend{
+		client:   client,
+		address:  address,
+		username: username,
+		password: password,
+		headers:  headers,
+	}
+}
+
+// Login does nothing as credentials are sent with every state request
+func (h *HTTPBackend) Login() error {
+	return nil
+}
+
+// GetSecrets gets secrets from terraform HTTP state backend and returns the formatted data
+func (h *HTTPBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedVersion("http", annotations); err != nil {
+		return nil, err
+	}
+
+	if ws := selectedWorkspace(annotations); ws != DefaultWorkspace {
+		return nil, fmt.Errorf("the http backend does not support workspaces, received %s", ws)
+	}
+
+	url := h.stateURL(path)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if h.username != "" || h.password != "" {
+		req.SetBasicAuth(h.username, h.password)
+	}
+	for name, value := range h.headers {
+		req.Header.Set(name, value)
+	}
+
+	utils.VerboseToStdErr("Terraform HTTP State getting %s", url)
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http get state: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return h.decode(path, data, annotations)
+	case http.StatusNoContent, http.StatusNotFound:
+		return nil, fmt.Errorf("no state found at %s", url)
+	default:
+		utils.VerboseToStdErr("Terraform HTTP State unexpected response: %s", string(data))
+		return nil, fmt.Errorf("http get state %s: unexpected status %s", url, resp.Status)
+	}
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the terraform HTTP state backend
+func (h *HTTPBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := h.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+func (h *HTTPBackend) stateURL(path string) string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return h.address
+	}
+
+	return strings.TrimSuffix(h.address, "/") + "/" + path
+}
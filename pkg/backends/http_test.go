@@ -0,0 +1,98 @@
+package backends_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+)
+
+func TestHTTPState(t *testing.T) {
+	st := backends.TFState{
+		Version: backends.StateVersion,
+		Outputs: map[string]*backends.TFOutput{
+			"test_string": {
+				Value: "str",
+			},
+		},
+	}
+	stateJson, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Private-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v4/projects/1/terraform/state/network":
+			w.Write(stateJson)
+		case "/api/v4/projects/1/terraform/state/empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	address := server.URL + "/api/v4/projects/1/terraform/state"
+	backend := backends.NewHTTPBackend(server.Client(), address, "user", "pass", map[string]string{
+		"Private-Token": "token",
+	})
+
+	t.Run("HTTP State GetSecrets()", func(t *testing.T) {
+		secrets, err := backend.GetSecrets("network", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secrets["test_string"] != "str" {
+			t.Fatalf("test_string secret expected to be str but received %v", secrets["test_string"])
+		}
+	})
+
+	t.Run("HTTP State GetIndividualSecret()", func(t *testing.T) {
+		val, err := backend.GetIndividualSecret("/network/", "test_string", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "str" {
+			t.Fatalf("test_string secret expected to be str but received %v", val)
+		}
+	})
+
+	t.Run("HTTP State without path uses the address", func(t *testing.T) {
+		backend := backends.NewHTTPBackend(server.Client(), address+"/network", "user", "pass", map[string]string{
+			"Private-Token": "token",
+		})
+		secrets, err := backend.GetSecrets("", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secrets["test_string"] != "str" {
+			t.Fatalf("test_string secret expected to be str but received %v", secrets["test_string"])
+		}
+	})
+
+	t.Run("HTTP State errors", func(t *testing.T) {
+		for _, path := range []string{"empty", "missing"} {
+			if _, err := backend.GetSecrets(path, nil); err == nil {
+				t.Fatalf("expected an error for %s", path)
+			}
+		}
+
+		unauthorized := backends.NewHTTPBackend(server.Client(), address, "user", "wrong", nil)
+		if _, err := unauthorized.GetSecrets("network", nil); err == nil {
+			t.Fatal("expected an error for wrong credentials")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+const (
+	kubernetesStateKey = "tfstate"
+)
+
+// SecretReader is an interface to read Kubernetes Secrets, satisfied by kube.Client.
+// It's needed to mock the cluster during tests
+type SecretReader interface {
+	ReadSecretData(name string) (map[string][]byte, error)
+}
+
+// KubernetesBackend is a struct for working with a Terraform kubernetes State backend
+type KubernetesBackend struct {
+	stateDecoder
+
+	client SecretReader
+}
+
+// NewKubernetesBackend initializes a new Terraform kubernetes State backend
+func NewKubernetesBackend(client SecretReader) *KubernetesBackend {
+	return &KubernetesBackend{
+		client: client,
+	}
+}
+
+// Login does nothing as a "login" is handled on the instantiation of the kubernetes client
+func (k *KubernetesBackend) Login() error {
+	return nil
+}
+
+// GetSecrets gets secrets from terraform kubernetes state backend and returns the formatted data.
+// `path` is the backend `secret_suffix`, optionally prefixed with `<namespace>:`
+func (k *KubernetesBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedVersion("kubernetes", annotations); err != nil {
+		return nil, err
+	}
+
+	name := kubernetesSecretName(path, selectedWorkspace(annotations))
+
+	utils.VerboseToStdErr("Terraform kubernetes State reading secret %s", name)
+	data, err := k.client.ReadSecretData(name)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes read secret: %w", err)
+	}
+
+	state, ok := data[kubernetesStateKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no %s key", name, kubernetesStateKey)
+	}
+
+	state, err = gunzip(state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress state: %w", err)
+	}
+
+	return k.decode(path, state, annotations)
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the terraform kubernetes state backend
+func (k *KubernetesBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := k.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+// kubernetesSecretName turns the secret suffix in `path` into the `tfstate-<workspace>-<suffix>` name
+// terraform uses, keeping an optional `<namespace>:` prefix
+func kubernetesSecretName(path, workspace string) string {
+	fields := strings.Split(path, ":")
+	last := len(fields) - 1
+	fields[last] = fmt.Sprintf("tfstate-%s-%s", workspace, fields[last])
+
+	return strings.Join(fields, ":")
+}
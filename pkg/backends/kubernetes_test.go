@@ -0,0 +1,80 @@
+package backends_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+)
+
+type mockSecretReader struct {
+	secrets map[string]map[string][]byte
+}
+
+func (m *mockSecretReader) ReadSecretData(name string) (map[string][]byte, error) {
+	if data, ok := m.secrets[name]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("secrets %q not found", name)
+}
+
+func TestKubernetesState(t *testing.T) {
+	stateJson, err := json.Marshal(backends.TFState{
+		Version: backends.StateVersion,
+		Outputs: map[string]*backends.TFOutput{
+			"cluster_endpoint": {Value: "https://10.0.0.1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock := &mockSecretReader{
+		secrets: map[string]map[string][]byte{
+			"tfstate-default-bootstrap": {
+				"tfstate": gzipData(t, stateJson),
+			},
+			"infra:tfstate-default-bootstrap": {
+				"tfstate": gzipData(t, stateJson),
+			},
+			"tfstate-default-nokey": {
+				"other": gzipData(t, stateJson),
+			},
+			"tfstate-default-plain": {
+				"tfstate": stateJson,
+			},
+		},
+	}
+	backend := backends.NewKubernetesBackend(mock)
+
+	t.Run("Kubernetes State GetSecrets()", func(t *testing.T) {
+		for _, path := range []string{"bootstrap", "infra:bootstrap"} {
+			secrets, err := backend.GetSecrets(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets["cluster_endpoint"] != "https://10.0.0.1" {
+				t.Fatalf("cluster_endpoint from %s expected to be https://10.0.0.1 but received %v", path, secrets["cluster_endpoint"])
+			}
+		}
+	})
+
+	t.Run("Kubernetes State GetIndividualSecret()", func(t *testing.T) {
+		val, err := backend.GetIndividualSecret("infra:bootstrap", "cluster_endpoint", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "https://10.0.0.1" {
+			t.Fatalf("cluster_endpoint expected to be https://10.0.0.1 but received %v", val)
+		}
+	})
+
+	t.Run("Kubernetes State errors", func(t *testing.T) {
+		for _, path := range []string{"missing", "nokey", "plain"} {
+			if _, err := backend.GetSecrets(path, nil); err == nil {
+				t.Fatalf("expected an error for %s", path)
+			}
+		}
+	})
+}
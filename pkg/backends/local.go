@@ -0,0 +1,93 @@
+package backends
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+const (
+	localStateFile    = "terraform.tfstate"
+	localWorkspaceDir = "terraform.tfstate.d"
+)
+
+// LocalBackend is a struct for working with Terraform states stored on the local filesystem
+type LocalBackend struct {
+	stateDecoder
+
+	root string
+}
+
+// NewLocalBackend initializes a new local filesystem State backend reading states below `root`
+func NewLocalBackend(root string) *LocalBackend {
+	return &LocalBackend{
+		root: root,
+	}
+}
+
+// Login does nothing as the local filesystem needs no authentication
+func (l *LocalBackend) Login() error {
+	return nil
+}
+
+// GetSecrets gets secrets from a terraform state file and returns the formatted data
+func (l *LocalBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedVersion("local", annotations); err != nil {
+		return nil, err
+	}
+
+	statePath, err := l.statePath(path, selectedWorkspace(annotations))
+	if err != nil {
+		return nil, err
+	}
+
+	utils.VerboseToStdErr("Terraform local State reading file %s", statePath)
+	data, err := ioutil.ReadFile(statePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read: %w", err)
+	}
+
+	return l.decode(path, data, annotations)
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the terraform state file
+func (l *LocalBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := l.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+// statePath resolves `path` below the backend root. Paths pointing to a directory,
+// e.g. a terraform project or a `terraform.tfstate.d/<workspace>` directory, resolve
+// to the `terraform.tfstate` file inside of it. Workspaces other than `default` resolve
+// to `terraform.tfstate.d/<workspace>/terraform.tfstate` next to the default state
+func (l *LocalBackend) statePath(path, workspace string) (string, error) {
+	statePath := filepath.Join(l.root, filepath.Clean(string(filepath.Separator)+path))
+
+	info, err := os.Stat(statePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", statePath, err)
+	}
+
+	if workspace != DefaultWorkspace {
+		if workspace == ".." || filepath.Base(workspace) != workspace {
+			return "", fmt.Errorf("invalid workspace %s", workspace)
+		}
+		if !info.IsDir() {
+			statePath = filepath.Dir(statePath)
+		}
+		return filepath.Join(statePath, localWorkspaceDir, workspace, localStateFile), nil
+	}
+
+	if info.IsDir() {
+		statePath = filepath.Join(statePath, localStateFile)
+	}
+
+	return statePath, nil
+}
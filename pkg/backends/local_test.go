@@ -0,0 +1,121 @@
+package backends_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+)
+
+func writeState(t *testing.T, path string, st backends.TFState) {
+	stateJson, err := json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, stateJson, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalState(t *testing.T) {
+	root := t.TempDir()
+	writeState(t, filepath.Join(root, "network", "terraform.tfstate"), backends.TFState{
+		Version: backends.StateVersion,
+		Outputs: map[string]*backends.TFOutput{
+			"vpc_id": {Value: "vpc-default"},
+		},
+	})
+	writeState(t, filepath.Join(root, "network", "terraform.tfstate.d", "staging", "terraform.tfstate"), backends.TFState{
+		Version: backends.StateVersion,
+		Outputs: map[string]*backends.TFOutput{
+			"vpc_id": {Value: "vpc-staging"},
+		},
+	})
+	writeState(t, filepath.Join(root, "app.tfstate"), backends.TFState{
+		Version: backends.StateVersion,
+		Outputs: map[string]*backends.TFOutput{
+			"db_host": {Value: "db.local"},
+		},
+	})
+
+	backend := backends.NewLocalBackend(root)
+
+	t.Run("Local State GetSecrets()", func(t *testing.T) {
+		testCases := map[string]string{
+			"network":                             "vpc-default",
+			"network/terraform.tfstate":           "vpc-default",
+			"network/terraform.tfstate.d/staging": "vpc-staging",
+		}
+		for path, expected := range testCases {
+			secrets, err := backend.GetSecrets(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets["vpc_id"] != expected {
+				t.Fatalf("vpc_id from %s expected to be %v but received %v", path, expected, secrets["vpc_id"])
+			}
+		}
+	})
+
+	t.Run("Local State GetIndividualSecret()", func(t *testing.T) {
+		val, err := backend.GetIndividualSecret("app.tfstate", "db_host", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "db.local" {
+			t.Fatalf("db_host expected to be db.local but received %v", val)
+		}
+
+		_, err = backend.GetIndividualSecret("app.tfstate", "missing", nil)
+		if err == nil {
+			t.Fatal("expected an error for a missing output")
+		}
+	})
+
+	t.Run("Local State workspaces", func(t *testing.T) {
+		staging := map[string]string{types.ATPWorkspaceAnnotation: "staging"}
+		for _, path := range []string{"network", "network/terraform.tfstate"} {
+			val, err := backend.GetIndividualSecret(path, "vpc_id", staging)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val != "vpc-staging" {
+				t.Fatalf("vpc_id from %s expected to be vpc-staging but received %v", path, val)
+			}
+		}
+
+		_, err := backend.GetSecrets("network", map[string]string{types.ATPWorkspaceAnnotation: "../.."})
+		if err == nil {
+			t.Fatal("expected an error for an invalid workspace")
+		}
+	})
+
+	t.Run("Local State versions are unsupported", func(t *testing.T) {
+		_, err := backend.GetSecrets("network", map[string]string{types.ATPVersionAnnotation: "v1"})
+		if err == nil {
+			t.Fatal("expected an error for a pinned version")
+		}
+	})
+
+	t.Run("Local State stays below root", func(t *testing.T) {
+		secrets, err := backend.GetSecrets("../../network", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secrets["vpc_id"] != "vpc-default" {
+			t.Fatalf("vpc_id expected to be vpc-default but received %v", secrets["vpc_id"])
+		}
+
+		_, err = backend.GetSecrets("missing", nil)
+		if err == nil {
+			t.Fatal("expected an error for a missing state")
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package backends
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+const (
+	outputsFileExt = ".json"
+)
+
+// OutputsBackend is a struct for working with the outputs terraform writes with `terraform output -json`,
+// for pipelines which publish the outputs of a stack instead of granting access to its state
+type OutputsBackend struct {
+	root string
+}
+
+// NewOutputsBackend initializes a new outputs backend reading `terraform output -json` files below `root`
+func NewOutputsBackend(root string) *OutputsBackend {
+	return &OutputsBackend{
+		root: root,
+	}
+}
+
+// Login does nothing as output files are read from the local filesystem
+func (o *OutputsBackend) Login() error {
+	return nil
+}
+
+// GetSecrets gets the outputs of the file at `path`. Paths pointing to a directory get the outputs of all
+// `.json` files inside of it, and the `.json` extension may be left out of file paths
+func (o *OutputsBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedVersion("outputs", annotations); err != nil {
+		return nil, err
+	}
+	if err := unsupportedChecks("outputs", annotations); err != nil {
+		return nil, err
+	}
+	if ws := selectedWorkspace(annotations); ws != DefaultWorkspace {
+		return nil, fmt.Errorf("the outputs backend does not support workspaces, received %s", ws)
+	}
+
+	files, err := o.outputFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make(map[string]*TFOutput)
+	for _, file := range files {
+		utils.VerboseToStdErr("Terraform outputs reading file %s", file)
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read: %w", err)
+		}
+
+		fileOutputs, err := parseOutputs(data)
+		if err != nil {
+			return nil, fmt.Errorf("outputs at %s: %w", file, err)
+		}
+		for name, output := range fileOutputs {
+			if _, ok := outputs[name]; ok {
+				return nil, fmt.Errorf("output %s is defined by more than one file of %s", name, path)
+			}
+			outputs[name] = output
+		}
+	}
+
+	state := TFState{Outputs: outputs}
+	return state.secrets(), nil
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the outputs at `path`
+func (o *OutputsBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := o.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+// outputFiles resolves `path` below the backend root to the files holding its outputs, in lexical order
+func (o *OutputsBackend) outputFiles(path string) ([]string, error) {
+	outputsPath := filepath.Join(o.root, filepath.Clean(string(filepath.Separator)+path))
+
+	info, err := os.Stat(outputsPath)
+	if os.IsNotExist(err) && !strings.HasSuffix(outputsPath, outputsFileExt) {
+		outputsPath += outputsFileExt
+		info, err = os.Stat(outputsPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", outputsPath, err)
+	}
+	if !info.IsDir() {
+		return []string{outputsPath}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(outputsPath, "*"+outputsFileExt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", outputsPath, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s files found in %s", outputsFileExt, outputsPath)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// parseOutputs decodes the outputs written by `terraform output -json`, which are shaped like the outputs
+// of a state. Numbers are kept as json.Number, like the outputs of states
+func parseOutputs(data []byte) (map[string]*TFOutput, error) {
+	var outputs map[string]*TFOutput
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&outputs)
+	if err != nil {
+		utils.VerboseToStdErr("Terraform outputs failed parsing json: %s: %s", string(data), err)
+		return nil, fmt.Errorf("failed to decode outputs from json, expected the output of `terraform output -json`: %w", err)
+	}
+
+	for name, output := range outputs {
+		if output == nil {
+			return nil, fmt.Errorf("output %s has no value", name)
+		}
+	}
+
+	return outputs, nil
+}
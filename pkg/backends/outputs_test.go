@@ -0,0 +1,93 @@
+package backends_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+)
+
+// networkOutputs is written by `terraform output -json`
+const networkOutputs = `{
+  "vpc_id": {"sensitive": false, "type": "string", "value": "vpc-123"},
+  "subnet_count": {"sensitive": false, "type": "number", "value": 3},
+  "db_password": {"sensitive": true, "type": "string", "value": "hunter2"}
+}`
+
+func writeOutputs(t *testing.T, path, outputs string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(outputs), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	root := t.TempDir()
+	writeOutputs(t, filepath.Join(root, "network.json"), networkOutputs)
+	writeOutputs(t, filepath.Join(root, "stacks", "network.json"), networkOutputs)
+	writeOutputs(t, filepath.Join(root, "stacks", "app.json"), `{"db_host": {"type": "string", "value": "db.internal"}}`)
+	writeOutputs(t, filepath.Join(root, "stacks", "README.md"), "not outputs")
+	writeOutputs(t, filepath.Join(root, "clash", "network.json"), networkOutputs)
+	writeOutputs(t, filepath.Join(root, "clash", "network-copy.json"), networkOutputs)
+	writeOutputs(t, filepath.Join(root, "state.json"), `{"version": 4, "outputs": {}}`)
+
+	backend := backends.NewOutputsBackend(root)
+
+	t.Run("Outputs GetSecrets()", func(t *testing.T) {
+		for _, path := range []string{"network.json", "network", "/../network.json", "stacks"} {
+			secrets, err := backend.GetSecrets(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets["vpc_id"] != "vpc-123" {
+				t.Fatalf("vpc_id from %s expected to be vpc-123 but received %v", path, secrets["vpc_id"])
+			}
+			if secrets["subnet_count"] != json.Number("3") {
+				t.Fatalf("subnet_count from %s expected to be 3 but received %#v", path, secrets["subnet_count"])
+			}
+			if _, ok := secrets["db_password"].(types.SensitiveValue); !ok {
+				t.Fatalf("db_password from %s expected to be sensitive but received %#v", path, secrets["db_password"])
+			}
+		}
+	})
+
+	t.Run("Outputs GetIndividualSecret()", func(t *testing.T) {
+		val, err := backend.GetIndividualSecret("stacks", "db_host", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "db.internal" {
+			t.Fatalf("db_host expected to be db.internal but received %v", val)
+		}
+
+		_, err = backend.GetIndividualSecret("stacks/app.json", "vpc_id", nil)
+		if err == nil {
+			t.Fatal("expected an error for an output of another file")
+		}
+	})
+
+	t.Run("Outputs failures", func(t *testing.T) {
+		testCases := []struct {
+			path        string
+			annotations map[string]string
+		}{
+			{"missing", nil},
+			{"clash", nil},
+			{"state.json", nil},
+			{"network", map[string]string{types.ATPWorkspaceAnnotation: "staging"}},
+			{"network", map[string]string{types.ATPVersionAnnotation: "v1"}},
+			{"network", map[string]string{types.ATPLineageAnnotation: "lineage"}},
+		}
+		for _, tc := range testCases {
+			if _, err := backend.GetSecrets(tc.path, tc.annotations); err == nil {
+				t.Fatalf("expected an error for %s with %v", tc.path, tc.annotations)
+			}
+		}
+	})
+}
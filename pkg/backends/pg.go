@@ -0,0 +1,95 @@
+package backends
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+	"github.com/lib/pq"
+)
+
+// PGClient is an interface to read states from PostgreSQL. It's needed to mock the database during tests
+type PGClient interface {
+	GetState(schema, name string) ([]byte, error)
+}
+
+// PGBackend is a struct for working with a Terraform pg State backend
+type PGBackend struct {
+	stateDecoder
+
+	client PGClient
+}
+
+type pgDBWrapper struct {
+	db *sql.DB
+}
+
+// GetState reads the state of workspace `name` from the `states` table terraform creates in `schema`
+func (w *pgDBWrapper) GetState(schema, name string) ([]byte, error) {
+	query := fmt.Sprintf("SELECT data FROM %s.states WHERE name = $1", pq.QuoteIdentifier(schema))
+
+	var data []byte
+	err := w.db.QueryRow(query, name).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no state for workspace %s in schema %s", name, schema)
+	}
+
+	return data, err
+}
+
+// WrapPGDB wraps a PostgreSQL sql.DB to match needed interface
+func WrapPGDB(db *sql.DB) PGClient {
+	return &pgDBWrapper{db: db}
+}
+
+// NewPGBackend initializes a new Terraform pg State backend
+func NewPGBackend(client PGClient) *PGBackend {
+	return &PGBackend{
+		client: client,
+	}
+}
+
+// Login does nothing as a "login" is handled on the instantiation of the database connection
+func (p *PGBackend) Login() error {
+	return nil
+}
+
+// GetSecrets gets secrets from terraform pg state backend and returns the formatted data.
+// `path` is the backend `schema_name`, optionally followed by `/<workspace>` which takes precedence
+// over the selected workspace
+func (p *PGBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedVersion("pg", annotations); err != nil {
+		return nil, err
+	}
+
+	schema, name := pgSchemaWorkspace(path, selectedWorkspace(annotations))
+
+	utils.VerboseToStdErr("Terraform pg State getting workspace %s from schema %s", name, schema)
+	data, err := p.client.GetState(schema, name)
+	if err != nil {
+		return nil, fmt.Errorf("pg get state: %w", err)
+	}
+
+	return p.decode(path, data, annotations)
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the terraform pg state backend
+func (p *PGBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := p.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+func pgSchemaWorkspace(path, workspace string) (string, string) {
+	fields := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+	if len(fields) == 2 {
+		return fields[0], fields[1]
+	}
+
+	return fields[0], workspace
+}
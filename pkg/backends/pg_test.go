@@ -0,0 +1,98 @@
+package backends_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+)
+
+type mockPGClient struct {
+	states map[string]map[string][]byte
+}
+
+func (m *mockPGClient) GetState(schema, name string) ([]byte, error) {
+	if workspaces, ok := m.states[schema]; ok {
+		if data, ok := workspaces[name]; ok {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("no state for workspace %s in schema %s", name, schema)
+}
+
+func TestPGState(t *testing.T) {
+	stateJson := func(value string) []byte {
+		data, err := json.Marshal(backends.TFState{
+			Version: backends.StateVersion,
+			Outputs: map[string]*backends.TFOutput{
+				"db_host": {Value: value},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	mock := &mockPGClient{
+		states: map[string]map[string][]byte{
+			"platform": {
+				"default": stateJson("db.default"),
+				"staging": stateJson("db.staging"),
+			},
+		},
+	}
+	backend := backends.NewPGBackend(mock)
+
+	t.Run("PG State GetSecrets()", func(t *testing.T) {
+		testCases := map[string]string{
+			"platform":          "db.default",
+			"platform/default":  "db.default",
+			"/platform/staging": "db.staging",
+		}
+		for path, expected := range testCases {
+			secrets, err := backend.GetSecrets(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets["db_host"] != expected {
+				t.Fatalf("db_host from %s expected to be %v but received %v", path, expected, secrets["db_host"])
+			}
+		}
+	})
+
+	t.Run("PG State GetIndividualSecret()", func(t *testing.T) {
+		val, err := backend.GetIndividualSecret("platform/staging", "db_host", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "db.staging" {
+			t.Fatalf("db_host expected to be db.staging but received %v", val)
+		}
+	})
+
+	t.Run("PG State workspaces", func(t *testing.T) {
+		staging := map[string]string{types.ATPWorkspaceAnnotation: "staging"}
+		testCases := map[string]string{
+			"platform":         "db.staging",
+			"platform/default": "db.default",
+		}
+		for path, expected := range testCases {
+			val, err := backend.GetIndividualSecret(path, "db_host", staging)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val != expected {
+				t.Fatalf("db_host from %s expected to be %v but received %v", path, expected, val)
+			}
+		}
+	})
+
+	t.Run("PG State missing workspace", func(t *testing.T) {
+		if _, err := backend.GetSecrets("platform/production", nil); err == nil {
+			t.Fatal("expected an error for a missing workspace")
+		}
+	})
+}
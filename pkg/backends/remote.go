@@ -0,0 +1,185 @@
+package backends
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+const (
+	// RemoteDefaultAddress is the Terraform Cloud address
+	RemoteDefaultAddress = "https://app.terraform.io"
+
+	remoteOutputsPageSize = 100
+)
+
+// RemoteBackend is a struct for working with Terraform Cloud / Enterprise workspaces
+type RemoteBackend struct {
+	client       types.HTTPClient
+	address      string
+	token        string
+	organization string
+}
+
+type remoteWorkspace struct {
+	Data struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+type remoteOutput struct {
+	ID         string `json:"id"`
+	Attributes struct {
+		Name         string      `json:"name"`
+		Sensitive    bool        `json:"sensitive"`
+		Value        interface{} `json:"value"`
+		DetailedType interface{} `json:"detailed-type"`
+	} `json:"attributes"`
+}
+
+type remoteOutputs struct {
+	Data  []remoteOutput `json:"data"`
+	Links struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+// NewRemoteBackend initializes a new Terraform Cloud / Enterprise backend.
+// `organization` is used for paths which don't name one
+func NewRemoteBackend(client types.HTTPClient, address, token, organization string) *RemoteBackend {
+	return &RemoteBackend{
+		client:       client,
+		address:      strings.TrimSuffix(address, "/"),
+		token:        token,
+		organization: organization,
+	}
+}
+
+// Login does nothing as the API token is sent with every request
+func (r *RemoteBackend) Login() error {
+	return nil
+}
+
+// GetSecrets gets the outputs of the current state version of a workspace and returns the formatted data.
+// `path` is the workspace name, optionally prefixed with `<organization>/`. When a workspace is selected,
+// `path` is the `workspaces { prefix }` of the backend and the workspace name is `<prefix><workspace>`
+func (r *RemoteBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedVersion("remote", annotations); err != nil {
+		return nil, err
+	}
+	if err := unsupportedChecks("remote", annotations); err != nil {
+		return nil, err
+	}
+
+	organization, workspace := r.organizationWorkspace(path)
+	if ws := selectedWorkspace(annotations); ws != DefaultWorkspace {
+		workspace += ws
+	}
+	if organization == "" {
+		return nil, fmt.Errorf("no organization given for workspace %s", workspace)
+	}
+
+	utils.VerboseToStdErr("Terraform remote State resolving workspace %s in organization %s", workspace, organization)
+	var ws remoteWorkspace
+	err := r.get(fmt.Sprintf("%s/api/v2/organizations/%s/workspaces/%s", r.address, url.PathEscape(organization), url.PathEscape(workspace)), &ws)
+	if err != nil {
+		return nil, err
+	}
+
+	state := TFState{
+		Outputs: map[string]*TFOutput{},
+	}
+	next := fmt.Sprintf("%s/api/v2/workspaces/%s/current-state-version-outputs?page%%5Bsize%%5D=%d", r.address, url.PathEscape(ws.Data.ID), remoteOutputsPageSize)
+	for next != "" {
+		var outputs remoteOutputs
+		err := r.get(next, &outputs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, output := range outputs.Data {
+			// Sensitive values may be redacted in listings, the output itself has them
+			if output.Attributes.Sensitive && output.Attributes.Value == nil {
+				var sensitive struct {
+					Data remoteOutput `json:"data"`
+				}
+				err := r.get(fmt.Sprintf("%s/api/v2/state-version-outputs/%s", r.address, url.PathEscape(output.ID)), &sensitive)
+				if err != nil {
+					return nil, err
+				}
+				output = sensitive.Data
+			}
+
+			state.Outputs[output.Attributes.Name] = &TFOutput{
+				Value:     output.Attributes.Value,
+				Type:      output.Attributes.DetailedType,
+				Sensitive: output.Attributes.Sensitive,
+			}
+		}
+
+		next = outputs.Links.Next
+	}
+
+	return state.secrets(), nil
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the outputs of a workspace
+func (r *RemoteBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := r.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+func (r *RemoteBackend) organizationWorkspace(path string) (string, string) {
+	fields := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+	if len(fields) == 2 {
+		return fields[0], fields[1]
+	}
+
+	return r.organization, fields[0]
+}
+
+func (r *RemoteBackend) get(endpoint string, result interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+r.token)
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+
+	utils.VerboseToStdErr("Terraform remote State getting %s", endpoint)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("terraform api request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		utils.VerboseToStdErr("Terraform remote State unexpected response: %s", string(data))
+		return fmt.Errorf("terraform api request %s: unexpected status %s", endpoint, resp.Status)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(result)
+	if err != nil {
+		return fmt.Errorf("failed to decode terraform api response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package backends_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+)
+
+func TestRemoteState(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer api-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v2/organizations/acme/workspaces/network":
+			fmt.Fprint(w, `{"data": {"id": "ws-123", "type": "workspaces"}}`)
+		case "/api/v2/workspaces/ws-123/current-state-version-outputs":
+			if r.URL.Query().Get("page[number]") == "2" {
+				fmt.Fprint(w, `{"data": [
+					{"id": "wsout-2", "attributes": {"name": "db_password", "sensitive": true, "value": null}}
+				], "links": {"next": null}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"data": [
+				{"id": "wsout-1", "attributes": {"name": "vpc_id", "sensitive": false, "value": "vpc-123"}}
+			], "links": {"next": "%s/api/v2/workspaces/ws-123/current-state-version-outputs?page%%5Bnumber%%5D=2"}}`, server.URL)
+		case "/api/v2/state-version-outputs/wsout-2":
+			fmt.Fprint(w, `{"data": {"id": "wsout-2", "attributes": {"name": "db_password", "sensitive": true, "value": "s3cr3t"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	backend := backends.NewRemoteBackend(server.Client(), server.URL, "api-token", "acme")
+
+	t.Run("Remote State GetSecrets()", func(t *testing.T) {
+		for _, path := range []string{"network", "acme/network"} {
+			secrets, err := backend.GetSecrets(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets["vpc_id"] != "vpc-123" {
+				t.Fatalf("vpc_id from %s expected to be vpc-123 but received %v", path, secrets["vpc_id"])
+			}
+			if secrets["db_password"] != (types.SensitiveValue{Value: "s3cr3t"}) {
+				t.Fatalf("db_password from %s expected to be s3cr3t but received %v", path, secrets["db_password"])
+			}
+		}
+	})
+
+	t.Run("Remote State GetIndividualSecret()", func(t *testing.T) {
+		val, err := backend.GetIndividualSecret("network", "vpc_id", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "vpc-123" {
+			t.Fatalf("vpc_id expected to be vpc-123 but received %v", val)
+		}
+	})
+
+	t.Run("Remote State errors", func(t *testing.T) {
+		if _, err := backend.GetSecrets("other/network", nil); err == nil {
+			t.Fatal("expected an error for a missing workspace")
+		}
+
+		noOrganization := backends.NewRemoteBackend(server.Client(), server.URL, "api-token", "")
+		if _, err := noOrganization.GetSecrets("network", nil); err == nil {
+			t.Fatal("expected an error without organization")
+		}
+
+		unauthorized := backends.NewRemoteBackend(server.Client(), server.URL, "wrong", "acme")
+		if _, err := unauthorized.GetSecrets("network", nil); err == nil {
+			t.Fatal("expected an error for a wrong token")
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+)
+
+const (
+	schemeSeparator = "://"
+)
+
+// BackendFactory builds the backend serving the `host` of a scheme-qualified state path,
+// e.g. the bucket of `s3://bucket/key`
+type BackendFactory func(host string) (types.Backend, error)
+
+// Router dispatches scheme-qualified state paths like `s3://bucket/key` to the backend registered
+// for the scheme, and any other path to the fallback backend
+type Router struct {
+	fallback  types.Backend
+	factories map[string]BackendFactory
+
+	mutex    sync.Mutex
+	backends map[string]types.Backend
+}
+
+// NewRouter initializes a new Router sending paths without a scheme to `fallback`
+func NewRouter(fallback types.Backend) *Router {
+	return &Router{
+		fallback:  fallback,
+		factories: map[string]BackendFactory{},
+		backends:  map[string]types.Backend{},
+	}
+}
+
+// Register serves paths with `scheme` from the backends built by `factory`
+func (r *Router) Register(scheme string, factory BackendFactory) {
+	r.factories[scheme] = factory
+}
+
+// Fallback returns the backend serving paths without a scheme
+func (r *Router) Fallback() types.Backend {
+	return r.fallback
+}
+
+// Serves tells whether paths with `scheme` are served
+func (r *Router) Serves(scheme string) bool {
+	_, ok := r.factories[scheme]
+	return ok
+}
+
+// Login logs in the fallback backend. Backends for schemes log in when they are first used
+func (r *Router) Login() error {
+	return r.fallback.Login()
+}
+
+// GetSecrets gets secrets from the backend serving `path`
+func (r *Router) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	backend, statePath, err := r.route(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.GetSecrets(statePath, annotations)
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the backend serving `path`
+func (r *Router) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	backend, statePath, err := r.route(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return backend.GetIndividualSecret(statePath, key, annotations)
+}
+
+// route returns the backend serving `path` and the path of the state inside of it
+func (r *Router) route(path string) (types.Backend, string, error) {
+	scheme, location, ok := splitScheme(path)
+	if !ok {
+		return r.fallback, path, nil
+	}
+
+	factory, ok := r.factories[scheme]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported state scheme %s in %s", scheme, path)
+	}
+
+	host, statePath := location, ""
+	if idx := strings.Index(location, "/"); idx >= 0 {
+		host, statePath = location[:idx], location[idx+1:]
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := scheme + schemeSeparator + host
+	backend, ok := r.backends[key]
+	if !ok {
+		utils.VerboseToStdErr("creating backend for %s", key)
+		var err error
+		backend, err = factory(host)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create backend for %s: %w", key, err)
+		}
+		err = backend.Login()
+		if err != nil {
+			return nil, "", err
+		}
+		r.backends[key] = backend
+	}
+
+	return backend, statePath, nil
+}
+
+// splitScheme splits `scheme://location` paths
+func splitScheme(path string) (string, string, bool) {
+	idx := strings.Index(path, schemeSeparator)
+	if idx <= 0 || strings.ContainsAny(path[:idx], "/#") {
+		return "", "", false
+	}
+
+	return strings.ToLower(path[:idx]), path[idx+len(schemeSeparator):], true
+}
@@ -0,0 +1,102 @@
+package backends_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+)
+
+// pathBackend returns the path it was asked for, prefixed with its name
+type pathBackend struct {
+	name   string
+	logins int
+}
+
+func (p *pathBackend) Login() error {
+	p.logins++
+	return nil
+}
+
+func (p *pathBackend) GetSecrets(path string, _ map[string]string) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"path": fmt.Sprintf("%s:%s", p.name, path),
+	}, nil
+}
+
+func (p *pathBackend) GetIndividualSecret(path, key string, _ map[string]string) (interface{}, error) {
+	return fmt.Sprintf("%s:%s#%s", p.name, path, key), nil
+}
+
+func TestRouter(t *testing.T) {
+	fallback := &pathBackend{name: "fallback"}
+	created := map[string]*pathBackend{}
+
+	router := backends.NewRouter(fallback)
+	router.Register("s3", func(host string) (types.Backend, error) {
+		if host == "broken" {
+			return nil, fmt.Errorf("broken bucket")
+		}
+		backend := &pathBackend{name: "s3-" + host}
+		created[host] = backend
+		return backend, nil
+	})
+
+	if router.Fallback() != fallback {
+		t.Fatal("expected the fallback backend")
+	}
+
+	if err := router.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if fallback.logins != 1 {
+		t.Fatalf("expected the fallback backend to login once but got %d", fallback.logins)
+	}
+
+	t.Run("routes paths", func(t *testing.T) {
+		testCases := map[string]string{
+			"path/to/state":          "fallback:path/to/state",
+			"infra:bootstrap":        "fallback:infra:bootstrap",
+			"s3://network/vpc.state": "s3-network:vpc.state",
+			"S3://network/a/b":       "s3-network:a/b",
+			"s3://app/app.tfstate":   "s3-app:app.tfstate",
+			"s3://bucket":            "s3-bucket:",
+			"dir/s3://not-a-scheme":  "fallback:dir/s3://not-a-scheme",
+		}
+		for path, expected := range testCases {
+			secrets, err := router.GetSecrets(path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if secrets["path"] != expected {
+				t.Fatalf("%s expected to be routed to %s but was routed to %s", path, expected, secrets["path"])
+			}
+		}
+
+		secret, err := router.GetIndividualSecret("s3://network/vpc.state", "vpc_id", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != "s3-network:vpc.state#vpc_id" {
+			t.Fatalf("unexpected routing %s", secret)
+		}
+	})
+
+	t.Run("reuses backends per host", func(t *testing.T) {
+		if len(created) != 3 {
+			t.Fatalf("expected 3 backends to be created but got %d", len(created))
+		}
+		if created["network"].logins != 1 {
+			t.Fatalf("expected backend to login once but got %d", created["network"].logins)
+		}
+	})
+
+	t.Run("fails on unknown schemes and broken backends", func(t *testing.T) {
+		for _, path := range []string{"gcs://bucket/state", "s3://broken/state"} {
+			if _, err := router.GetSecrets(path, nil); err == nil {
+				t.Fatalf("expected an error for %s", path)
+			}
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package backends
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+	"github.com/hashicorp/vault/api"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/signer"
+)
+
+const (
+	// S3DefaultSTSEndpoint is the global AWS STS endpoint
+	S3DefaultSTSEndpoint = "https://sts.amazonaws.com"
+	// S3DefaultSTSRegion is the region requests to the global STS endpoint are signed for
+	S3DefaultSTSRegion = "us-east-1"
+	// S3DefaultRoleSessionName names the sessions of assumed roles
+	S3DefaultRoleSessionName = "argocd-terraform-plugin"
+
+	s3AssumeRoleDuration = time.Hour
+	// vaultStaticCredentialsTTL is how long credentials without a lease, e.g. from a KV secret, are used before reading them again
+	vaultStaticCredentialsTTL = time.Hour
+)
+
+// S3AssumeRole is a minio credentials provider assuming a role with the credentials of another provider.
+// Unlike credentials.STSAssumeRole it signs with temporary credentials too, so roles can be chained,
+// e.g. from the role of the repo-server service account to the role reading the state bucket
+type S3AssumeRole struct {
+	credentials.Expiry
+
+	client      types.HTTPClient
+	source      *credentials.Credentials
+	endpoint    string
+	region      string
+	roleARN     string
+	sessionName string
+	externalID  string
+}
+
+// NewS3AssumeRole initializes new credentials assuming `roleARN` through the STS `endpoint` in `region`
+// with the `source` credentials. `externalID` is optional
+func NewS3AssumeRole(client types.HTTPClient, source *credentials.Credentials, endpoint, region, roleARN, sessionName, externalID string) *credentials.Credentials {
+	if sessionName == "" {
+		sessionName = S3DefaultRoleSessionName
+	}
+
+	return credentials.New(&S3AssumeRole{
+		client:      client,
+		source:      source,
+		endpoint:    endpoint,
+		region:      region,
+		roleARN:     roleARN,
+		sessionName: sessionName,
+		externalID:  externalID,
+	})
+}
+
+// NewS3WebIdentity initializes new credentials assuming `roleARN` with the web identity token in `tokenFile`,
+// e.g. the projected service account token of IRSA. The file is read on every refresh as the token rotates
+func NewS3WebIdentity(client *http.Client, endpoint, roleARN, tokenFile string) *credentials.Credentials {
+	return credentials.New(&credentials.STSWebIdentity{
+		Client:      client,
+		STSEndpoint: endpoint,
+		RoleARN:     roleARN,
+		GetWebIDTokenExpiry: func() (*credentials.WebIdentityToken, error) {
+			token, err := ioutil.ReadFile(tokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read web identity token: %w", err)
+			}
+			return &credentials.WebIdentityToken{Token: strings.TrimSpace(string(token))}, nil
+		},
+	})
+}
+
+// S3VaultCredentials is a minio credentials provider reading credentials from Vault. They are either generated by the
+// AWS secrets engine, e.g. at `aws/creds/<role>` or `aws/sts/<role>`, or stored in a KV v1 or v2 secret with the same
+// `access_key`, `secret_key` and optional `security_token` keys
+type S3VaultCredentials struct {
+	credentials.Expiry
+
+	client   *api.Client
+	auth     types.AuthType
+	path     string
+	loggedIn bool
+}
+
+// NewS3VaultCredentials initializes new credentials read from `path` after logging in Vault with `auth`
+func NewS3VaultCredentials(client *api.Client, auth types.AuthType, path string) *credentials.Credentials {
+	return credentials.New(&S3VaultCredentials{
+		client: client,
+		auth:   auth,
+		path:   path,
+	})
+}
+
+// Retrieve reads the credentials, leased credentials expire before their lease ends
+func (s *S3VaultCredentials) Retrieve() (credentials.Value, error) {
+	if !s.loggedIn {
+		err := vaultLogin(s.client, s.auth)
+		if err != nil {
+			return credentials.Value{}, fmt.Errorf("failed to login to vault: %w", err)
+		}
+		s.loggedIn = true
+	}
+
+	utils.VerboseToStdErr("S3 reading credentials from vault %s", s.path)
+	secret, err := s.client.Logical().Read(s.path)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("failed to read s3 credentials from vault %s: %w", s.path, err)
+	}
+	if secret == nil {
+		return credentials.Value{}, fmt.Errorf("no s3 credentials found in vault at %s", s.path)
+	}
+
+	data := secret.Data
+	// KV v2 nests the secret with its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		data = nested
+	}
+	accessKey, _ := data["access_key"].(string)
+	secretKey, _ := data["secret_key"].(string)
+	sessionToken, _ := data["security_token"].(string)
+	if accessKey == "" || secretKey == "" {
+		return credentials.Value{}, fmt.Errorf("vault secret %s has no access_key and secret_key", s.path)
+	}
+
+	if secret.LeaseDuration > 0 {
+		s.SetExpiration(time.Now().Add(time.Duration(secret.LeaseDuration)*time.Second), -1)
+	} else {
+		s.SetExpiration(time.Now().Add(vaultStaticCredentialsTTL), 0)
+	}
+
+	return credentials.Value{
+		AccessKeyID:     accessKey,
+		SecretAccessKey: secretKey,
+		SessionToken:    sessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
+
+// Retrieve assumes the role and returns its temporary credentials
+func (a *S3AssumeRole) Retrieve() (credentials.Value, error) {
+	source, err := a.source.Get()
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("failed to get source credentials to assume %s: %w", a.roleARN, err)
+	}
+
+	form := url.Values{}
+	form.Set("Action", "AssumeRole")
+	form.Set("Version", credentials.STSVersion)
+	form.Set("RoleArn", a.roleARN)
+	form.Set("RoleSessionName", a.sessionName)
+	form.Set("DurationSeconds", strconv.Itoa(int(s3AssumeRoleDuration.Seconds())))
+	if a.externalID != "" {
+		form.Set("ExternalId", a.externalID)
+	}
+	body := form.Encode()
+	payloadHash := sha256.Sum256([]byte(body))
+
+	req, err := http.NewRequest(http.MethodPost, a.endpoint, strings.NewReader(body))
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if source.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", source.SessionToken)
+	}
+	req = signer.SignV4STS(*req, source.AccessKeyID, source.SecretAccessKey, a.region)
+
+	utils.VerboseToStdErr("S3 assuming role %s", a.roleARN)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("sts assume role request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("failed to read: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return credentials.Value{}, fmt.Errorf("failed to assume role %s: unexpected status %s: %s", a.roleARN, resp.Status, string(data))
+	}
+
+	var result credentials.AssumeRoleResponse
+	err = xml.Unmarshal(data, &result)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("failed to decode sts response: %w", err)
+	}
+
+	creds := result.Result.Credentials
+	a.SetExpiration(creds.Expiration, credentials.DefaultExpiryWindow)
+
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKey,
+		SecretAccessKey: creds.SecretKey,
+		SessionToken:    creds.SessionToken,
+		SignerType:      credentials.SignatureV4,
+	}, nil
+}
@@ -0,0 +1,171 @@
+package backends_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/auth/vault"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/helpers"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/hashicorp/vault/api"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const stsResponse = `<%[1]sResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <%[1]sResult>
+    <Credentials>
+      <AccessKeyId>%[2]s</AccessKeyId>
+      <SecretAccessKey>%[2]s-secret</SecretAccessKey>
+      <SessionToken>%[2]s-token</SessionToken>
+      <Expiration>%[3]s</Expiration>
+    </Credentials>
+  </%[1]sResult>
+</%[1]sResponse>`
+
+// newSTSServer serves AssumeRoleWithWebIdentity for `webIdentityToken`, and AssumeRole for requests signed
+// with the web identity credentials, like the chain of an IRSA role assuming the role of a state bucket
+func newSTSServer(webIdentityToken string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+		switch r.PostForm.Get("Action") {
+		case "AssumeRoleWithWebIdentity":
+			if r.PostForm.Get("WebIdentityToken") != webIdentityToken || r.PostForm.Get("RoleArn") != "arn:aws:iam::111111111111:role/repo-server" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, stsResponse, "AssumeRoleWithWebIdentity", "web-identity", expiration)
+		case "AssumeRole":
+			if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=web-identity/") ||
+				!strings.Contains(r.Header.Get("Authorization"), "x-amz-security-token") ||
+				r.Header.Get("X-Amz-Security-Token") != "web-identity-token" ||
+				r.PostForm.Get("RoleArn") != "arn:aws:iam::222222222222:role/tf-states" ||
+				r.PostForm.Get("ExternalId") != "external" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, stsResponse, "AssumeRole", "assumed", expiration)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestS3AssumeRole(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("service-account-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	server := newSTSServer("service-account-token")
+	defer server.Close()
+
+	webIdentity := backends.NewS3WebIdentity(server.Client(), server.URL, "arn:aws:iam::111111111111:role/repo-server", tokenFile)
+	value, err := webIdentity.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.AccessKeyID != "web-identity" || value.SessionToken != "web-identity-token" {
+		t.Fatalf("expected web identity credentials but got %v", value)
+	}
+
+	assumed := backends.NewS3AssumeRole(server.Client(), webIdentity, server.URL, "us-east-1", "arn:aws:iam::222222222222:role/tf-states", "", "external")
+	value, err = assumed.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.AccessKeyID != "assumed" || value.SecretAccessKey != "assumed-secret" || value.SessionToken != "assumed-token" {
+		t.Fatalf("expected assumed credentials but got %v", value)
+	}
+
+	t.Run("failures are reported", func(t *testing.T) {
+		denied := backends.NewS3AssumeRole(server.Client(), webIdentity, server.URL, "us-east-1", "arn:aws:iam::222222222222:role/other", "", "")
+		if _, err := denied.Get(); err == nil {
+			t.Fatal("expected an error for a denied role")
+		}
+	})
+}
+
+func TestS3VaultCredentials(t *testing.T) {
+	cluster, username, password := helpers.CreateTestUserPassVault(t)
+	defer cluster.Cleanup()
+
+	root := cluster.Cores[0].Client
+	secrets := map[string]map[string]interface{}{
+		"secret/s3": {"access_key": "kv1", "secret_key": "kv1-secret"},
+		"kv/data/s3": {"data": map[string]interface{}{
+			"access_key":     "kv2",
+			"secret_key":     "kv2-secret",
+			"security_token": "kv2-token",
+		}},
+		"secret/incomplete": {"access_key": "incomplete"},
+	}
+	for path, data := range secrets {
+		if _, err := root.Logical().Write(path, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newClient := func(token string) *api.Client {
+		client, err := root.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SetToken(token)
+		return client
+	}
+
+	testCases := []struct {
+		name     string
+		client   *api.Client
+		auth     types.AuthType
+		path     string
+		expected credentials.Value
+	}{
+		{
+			"kv v1 with token auth",
+			newClient(root.Token()),
+			&vault.TokenAuth{},
+			"secret/s3",
+			credentials.Value{AccessKeyID: "kv1", SecretAccessKey: "kv1-secret"},
+		},
+		{
+			"kv v2 with userpass auth",
+			newClient(""),
+			vault.NewUserPassAuth(username, password, ""),
+			"kv/data/s3",
+			credentials.Value{AccessKeyID: "kv2", SecretAccessKey: "kv2-secret", SessionToken: "kv2-token"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			value, err := backends.NewS3VaultCredentials(tc.client, tc.auth, tc.path).Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.expected.SignerType = credentials.SignatureV4
+			if value != tc.expected {
+				t.Fatalf("expected %v but got %v", tc.expected, value)
+			}
+		})
+	}
+
+	t.Run("secrets without credentials are reported", func(t *testing.T) {
+		for _, path := range []string{"secret/incomplete", "secret/missing"} {
+			creds := backends.NewS3VaultCredentials(newClient(root.Token()), &vault.TokenAuth{}, path)
+			if _, err := creds.Get(); err == nil {
+				t.Fatalf("expected an error for %s", path)
+			}
+		}
+	})
+}
@@ -7,9 +7,26 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+	"github.com/hashicorp/go-version"
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+const (
+	// DefaultWorkspace is the terraform workspace used when none is selected
+	DefaultWorkspace = "default"
+	// S3DefaultWorkspaceKeyPrefix is the default `workspace_key_prefix` of the terraform s3 backend
+	S3DefaultWorkspaceKeyPrefix = "env:"
+	// StateVersion is the version of the state format written by terraform 0.12 and later
+	StateVersion = 4
+
+	workspaceKeySuffix = "env:"
 )
 
 // MinioClient is an interface to work with S3. It's needed to mock S3 communication during tests
@@ -17,18 +34,59 @@ type MinioClient interface {
 	GetObject(ctx context.Context, bucket, path string, opt minio.GetObjectOptions) (io.Reader, error)
 }
 
+// minioObject is implemented by the objects of minio.Client, it's used to read the ETag of a state
+type minioObject interface {
+	Stat() (minio.ObjectInfo, error)
+}
+
 // S3Backend is a struct for working with a Terraform State backend
 type S3Backend struct {
-	client MinioClient
-	bucket string
+	stateDecoder
+
+	client             MinioClient
+	bucket             string
+	workspaceKeyPrefix string
+	cache              *DiskCache
+	sse                encrypt.ServerSide
 }
 
 type TFOutput struct {
 	Value interface{}
+	// Type is the terraform type of the output, e.g. `"string"` or `["map", "number"]`
+	Type      interface{} `json:"type,omitempty"`
+	Sensitive bool        `json:"sensitive,omitempty"`
+}
+
+// TFResource is a resource or data source of a version 4 state
+type TFResource struct {
+	Module    string                `json:"module,omitempty"`
+	Mode      string                `json:"mode"`
+	Type      string                `json:"type"`
+	Name      string                `json:"name"`
+	Instances []*TFResourceInstance `json:"instances"`
+}
+
+// TFResourceInstance is an instance of a resource, `IndexKey` is set for resources using `count` or `for_each`
+type TFResourceInstance struct {
+	IndexKey   interface{}            `json:"index_key,omitempty"`
+	Attributes map[string]interface{} `json:"attributes"`
+	// SensitiveAttributes lists the paths of sensitive attributes, each path is a list of steps like
+	// `{"type": "get_attr", "value": "password"}`
+	SensitiveAttributes json.RawMessage `json:"sensitive_attributes,omitempty"`
+}
+
+type tfPathStep struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
 }
 
 type TFState struct {
-	Outputs map[string]*TFOutput `json:"outputs"`
+	Version          int                  `json:"version"`
+	TerraformVersion string               `json:"terraform_version,omitempty"`
+	Serial           uint64               `json:"serial"`
+	Lineage          string               `json:"lineage,omitempty"`
+	Outputs          map[string]*TFOutput `json:"outputs"`
+	Resources        []*TFResource        `json:"resources,omitempty"`
 }
 
 type minioClientWrapper struct {
@@ -44,11 +102,24 @@ func WrapMinioClient(c *minio.Client) MinioClient {
 	return &minioClientWrapper{mcl: c}
 }
 
-// NewS3Backend initializes a new Terraform S3 State backend
-func NewS3Backend(client MinioClient, bucket string) *S3Backend {
+// NewS3Backend initializes a new Terraform S3 State backend. States of workspaces other than `default`
+// are read from `<workspaceKeyPrefix>/<workspace>/<path>`, like the terraform s3 backend writes them.
+// `cache` may be nil to always download states, `sse` is the SSE-C key of the states or nil if they aren't encrypted with one.
+// States encrypted with an SSE-C key are never cached, as the disk cache would store them decrypted
+func NewS3Backend(client MinioClient, bucket, workspaceKeyPrefix string, cache *DiskCache, sse encrypt.ServerSide) *S3Backend {
+	if workspaceKeyPrefix == "" {
+		workspaceKeyPrefix = S3DefaultWorkspaceKeyPrefix
+	}
+	if sse != nil {
+		cache = nil
+	}
+
 	return &S3Backend{
-		client: client,
-		bucket: bucket,
+		client:             client,
+		bucket:             bucket,
+		workspaceKeyPrefix: workspaceKeyPrefix,
+		cache:              cache,
+		sse:                sse,
 	}
 }
 
@@ -58,11 +129,32 @@ func (ycl *S3Backend) Login() error {
 }
 
 // GetSecrets gets secrets from terraform state backend and returns the formatted data
-func (ycl *S3Backend) GetSecrets(path string, _ map[string]string) (map[string]interface{}, error) {
+func (ycl *S3Backend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+
+	var options = minio.GetObjectOptions{
+		VersionID:            annotations[types.ATPVersionAnnotation],
+		ServerSideEncryption: ycl.sse,
+	}
+
+	if ws := selectedWorkspace(annotations); ws != DefaultWorkspace {
+		path = fmt.Sprintf("%s/%s/%s", strings.Trim(ycl.workspaceKeyPrefix, "/"), ws, strings.TrimPrefix(path, "/"))
+	}
 
-	var options = minio.GetObjectOptions{}
+	cacheKey := fmt.Sprintf("s3://%s/%s?versionId=%s", ycl.bucket, path, options.VersionID)
+	entry := ycl.cache.Get(cacheKey)
+	// Object versions never change, so a cached version is always current
+	if entry != nil && (entry.Fresh || options.VersionID != "") {
+		utils.VerboseToStdErr("Terraform S3 State using object %s cached on disk", path)
+		return ycl.decode(path, entry.Data, annotations)
+	}
+	if entry != nil && entry.ETag != "" {
+		err := options.SetMatchETagExcept(entry.ETag)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	utils.VerboseToStdErr("Terraform S3 State getting object %s", path)
+	utils.VerboseToStdErr("Terraform S3 State getting object %s (version %q)", path, options.VersionID)
 	obj, err := ycl.client.GetObject(context.Background(), ycl.bucket, path, options)
 	if err != nil {
 		return nil, fmt.Errorf("mc get object: %w", err)
@@ -70,38 +162,204 @@ func (ycl *S3Backend) GetSecrets(path string, _ map[string]string) (map[string]i
 
 	utils.VerboseToStdErr("Terraform S3 State got object %v", obj)
 
+	var etag string
+	if object, ok := obj.(minioObject); ok && ycl.cache != nil {
+		info, err := object.Stat()
+		if entry != nil && minio.ToErrorResponse(err).StatusCode == http.StatusNotModified {
+			utils.VerboseToStdErr("Terraform S3 State object %s cached on disk is still current", path)
+			ycl.cache.Touch(cacheKey)
+			return ycl.decode(path, entry.Data, annotations)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mc stat object: %w", err)
+		}
+		etag = info.ETag
+	}
+
 	data, err := ioutil.ReadAll(obj)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read: %w", err)
 	}
-	var state TFState
-	// state.Init()
-	err = json.NewDecoder(bytes.NewReader(data)).Decode(&state)
+	ycl.cache.Put(cacheKey, data, etag)
+
+	return ycl.decode(path, data, annotations)
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the terraform state backend
+func (ycl *S3Backend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := ycl.GetSecrets(path, annotations)
 	if err != nil {
-		utils.VerboseToStdErr("Terraform S3 State failed parsing json: %s: %w", string(data), err)
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+// selectedWorkspace returns the terraform workspace selected by `annotations`
+func selectedWorkspace(annotations map[string]string) string {
+	if ws := annotations[types.ATPWorkspaceAnnotation]; ws != "" {
+		return ws
+	}
+
+	return DefaultWorkspace
+}
+
+// unsupportedVersion fails when `annotations` pin a state version, as `backend` can't read older states
+func unsupportedVersion(backend string, annotations map[string]string) error {
+	if version := annotations[types.ATPVersionAnnotation]; version != "" {
+		return fmt.Errorf("the %s backend does not support state versions, received %s", backend, version)
+	}
+
+	return nil
+}
+
+// unsupportedChecks fails when `annotations` expect a lineage or serial, as `backend` only returns the outputs of a state
+func unsupportedChecks(backend string, annotations map[string]string) error {
+	for _, name := range []string{types.ATPLineageAnnotation, types.ATPMinSerialAnnotation} {
+		if value := annotations[name]; value != "" {
+			return fmt.Errorf("the %s backend does not support the %s annotation, received %s", backend, name, value)
+		}
+	}
+
+	return nil
+}
 
+// parseState decodes the terraform state at `path`, checks it against `annotations` and returns its outputs.
+// Numbers are kept as json.Number, so large IDs and ports render exactly instead of as a float
+func parseState(path string, data []byte, annotations map[string]string) (map[string]interface{}, error) {
+	var state TFState
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&state)
+	if err != nil {
+		utils.VerboseToStdErr("Terraform State failed parsing json: %s: %s", string(data), err)
 		return nil, fmt.Errorf("failed to decode state from json: %w", err)
 	}
 
+	err = state.validate(annotations)
+	if err != nil {
+		return nil, fmt.Errorf("state at %s: %w", path, err)
+	}
+
+	return state.secrets(), nil
+}
+
+// validate checks the state is in a supported format, and comes from the lineage and has at least the serial
+// `annotations` expect. A different lineage means the state was overwritten by the state of another stack
+func (s *TFState) validate(annotations map[string]string) error {
+	if s.Version != StateVersion {
+		return fmt.Errorf("unsupported state version %d, only version %d states written by terraform 0.12 and later are supported", s.Version, StateVersion)
+	}
+	if s.TerraformVersion != "" {
+		_, err := version.NewVersion(s.TerraformVersion)
+		if err != nil {
+			return fmt.Errorf("invalid terraform_version %s: %w", s.TerraformVersion, err)
+		}
+	}
+
+	if lineage := annotations[types.ATPLineageAnnotation]; lineage != "" && lineage != s.Lineage {
+		return fmt.Errorf("lineage %s does not match the expected lineage %s", s.Lineage, lineage)
+	}
+
+	if minSerial := annotations[types.ATPMinSerialAnnotation]; minSerial != "" {
+		serial, err := strconv.ParseUint(minSerial, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s annotation %s: %w", types.ATPMinSerialAnnotation, minSerial, err)
+		}
+		if s.Serial < serial {
+			return fmt.Errorf("serial %d is older than the expected serial %d", s.Serial, serial)
+		}
+	}
+
+	return nil
+}
+
+// secrets returns the values of the state outputs by their name, along with the attributes of resource instances.
+// An instance address like `module.db.aws_db_instance.main[0]` holds all attributes of the instance, and every
+// attribute is available on its own as `<address>.<attribute>`. Output names can't contain dots, so they never clash.
+// Sensitive outputs and attributes, and instances with any sensitive attribute, are wrapped in a types.SensitiveValue
+func (s *TFState) secrets() map[string]interface{} {
 	results := make(map[string]interface{})
-	for key, output := range state.Outputs {
-		results[key] = output.Value
+	for _, resource := range s.Resources {
+		for _, instance := range resource.Instances {
+			address := resource.address(instance.IndexKey)
+			sensitive, all := instance.sensitiveAttributes()
+			results[address] = sensitiveValue(instance.Attributes, all || len(sensitive) > 0)
+			for name, value := range instance.Attributes {
+				results[address+"."+name] = sensitiveValue(value, all || sensitive[name])
+			}
+		}
 	}
 
-	return results, nil
+	for key, output := range s.Outputs {
+		results[key] = sensitiveValue(typedValue(output.Value, output.Type), output.Sensitive)
+	}
+
+	return results
 }
 
-// GetIndividualSecret will get the specific secret (placeholder) from the terraform state backend
-func (ycl *S3Backend) GetIndividualSecret(path, key string, _ map[string]string) (interface{}, error) {
-	secrets, err := ycl.GetSecrets(path, nil)
+// sensitiveAttributes returns the names of the attributes holding sensitive values. It returns true if
+// the paths can't be told apart, in which case all attributes must be treated as sensitive
+func (i *TFResourceInstance) sensitiveAttributes() (map[string]bool, bool) {
+	names := map[string]bool{}
+	if len(i.SensitiveAttributes) == 0 {
+		return names, false
+	}
+
+	var paths [][]tfPathStep
+	err := json.Unmarshal(i.SensitiveAttributes, &paths)
 	if err != nil {
-		return nil, err
+		utils.VerboseToStdErr("Terraform State treating all attributes as sensitive, failed to decode sensitive_attributes: %s", err)
+		return names, true
 	}
 
+	for _, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		name, ok := path[0].Value.(string)
+		if path[0].Type != "get_attr" || !ok {
+			return names, true
+		}
+		names[name] = true
+	}
+
+	return names, false
+}
+
+func sensitiveValue(value interface{}, sensitive bool) interface{} {
+	if sensitive {
+		return types.SensitiveValue{Value: value}
+	}
+
+	return value
+}
+
+// address returns the address terraform shows for the instance of the resource with `indexKey`
+func (r *TFResource) address(indexKey interface{}) string {
+	address := r.Type + "." + r.Name
+	if r.Mode == "data" {
+		address = "data." + address
+	}
+	if r.Module != "" {
+		address = r.Module + "." + address
+	}
+
+	switch key := indexKey.(type) {
+	case nil:
+		return address
+	case string:
+		return fmt.Sprintf("%s[%q]", address, key)
+	default:
+		return fmt.Sprintf("%s[%v]", address, key)
+	}
+}
+
+// individualSecret picks the output `key` from the outputs of the state at `path`
+func individualSecret(secrets map[string]interface{}, path, key string) (interface{}, error) {
 	secret, found := secrets[key]
 	if !found {
-		utils.VerboseToStdErr("Terraform S3 State existing secrets: %v", secrets)
-
+		utils.VerboseToStdErr("Terraform State existing secrets: %v", secrets)
 		return nil, fmt.Errorf("path: %s, key: %s not found", path, key)
 	}
 
@@ -3,14 +3,19 @@ package backends_test
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 )
 
 type mockMinioClient struct {
@@ -24,6 +29,9 @@ func newMockMinioClient() *mockMinioClient {
 }
 
 func (m *mockMinioClient) GetObject(_ context.Context, bucketName, path string, opt minio.GetObjectOptions) (io.Reader, error) {
+	if opt.VersionID != "" {
+		path += "?versionId=" + opt.VersionID
+	}
 	if bucket, ok := m.objects[bucketName]; ok {
 		if obj, ok := bucket[path]; ok {
 			return bytes.NewReader(obj), nil
@@ -52,6 +60,7 @@ func TestTerraformState(t *testing.T) {
 	bucketName := "argocd-test"
 	path := "/test/case/1/terraform.state"
 	st := backends.TFState{
+		Version: backends.StateVersion,
 		Outputs: map[string]*backends.TFOutput{
 			"test_string": {
 				Value: strVal,
@@ -67,7 +76,7 @@ func TestTerraformState(t *testing.T) {
 	mock := newMockMinioClient()
 	mock.setObject(bucketName, path, stateJson)
 
-	backend := backends.NewS3Backend(mock, bucketName)
+	backend := backends.NewS3Backend(mock, bucketName, "", nil, nil)
 
 	t.Run("Terraform State GetSecrets()", func(t *testing.T) {
 
@@ -107,4 +116,295 @@ func TestTerraformState(t *testing.T) {
 			t.Fatalf("test_obj secret expected to be %v but received %v", objVal, realObjVal)
 		}
 	})
+
+	t.Run("Terraform State workspaces", func(t *testing.T) {
+		stagingJson, err := json.Marshal(backends.TFState{
+			Version: backends.StateVersion,
+			Outputs: map[string]*backends.TFOutput{
+				"test_string": {Value: "staging"},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.setObject(bucketName, "env:/staging/test/case/1/terraform.state", stagingJson)
+		mock.setObject(bucketName, "workspaces/staging/test/case/1/terraform.state", stagingJson)
+
+		staging := map[string]string{types.ATPWorkspaceAnnotation: "staging"}
+		for _, backend := range []*backends.S3Backend{backend, backends.NewS3Backend(mock, bucketName, "workspaces", nil, nil)} {
+			val, err := backend.GetIndividualSecret(path, "test_string", staging)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val != "staging" {
+				t.Fatalf("test_string secret expected to be staging but received %v", val)
+			}
+		}
+	})
+
+	t.Run("Terraform State versions", func(t *testing.T) {
+		previousJson, err := json.Marshal(backends.TFState{
+			Version: backends.StateVersion,
+			Outputs: map[string]*backends.TFOutput{
+				"test_string": {Value: "previous"},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mock.setObject(bucketName, path+"?versionId=v1", previousJson)
+
+		val, err := backend.GetIndividualSecret(path, "test_string", map[string]string{types.ATPVersionAnnotation: "v1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val != "previous" {
+			t.Fatalf("test_string secret expected to be previous but received %v", val)
+		}
+
+		_, err = backend.GetSecrets(path, map[string]string{types.ATPVersionAnnotation: "missing"})
+		if err == nil {
+			t.Fatal("expected an error for a missing version")
+		}
+	})
+}
+
+func TestTerraformStateResources(t *testing.T) {
+	state := `{
+		"version": 4,
+		"outputs": {"vpc_id": {"value": "vpc-123", "type": "string"}},
+		"resources": [
+			{
+				"mode": "managed", "type": "aws_db_instance", "name": "main",
+				"instances": [{"attributes": {"address": "db.internal", "port": 5432}}]
+			},
+			{
+				"mode": "managed", "type": "aws_instance", "name": "web",
+				"instances": [
+					{"index_key": 0, "attributes": {"private_ip": "10.0.0.1"}},
+					{"index_key": 1, "attributes": {"private_ip": "10.0.0.2"}}
+				]
+			},
+			{
+				"module": "module.cache[\"eu\"]", "mode": "managed", "type": "aws_elasticache_cluster", "name": "this",
+				"instances": [{"index_key": "primary", "attributes": {"cache_nodes": [{"address": "cache.internal"}]}}]
+			},
+			{
+				"mode": "data", "type": "aws_ami", "name": "ubuntu",
+				"instances": [{"attributes": {"id": "ami-123"}}]
+			}
+		]
+	}`
+	mock := newMockMinioClient()
+	mock.setObject("argocd-test", "state", []byte(state))
+	backend := backends.NewS3Backend(mock, "argocd-test", "", nil, nil)
+
+	testCases := map[string]interface{}{
+		"vpc_id":                         "vpc-123",
+		"aws_db_instance.main.address":   "db.internal",
+		"aws_instance.web[1].private_ip": "10.0.0.2",
+		"data.aws_ami.ubuntu.id":         "ami-123",
+		"module.cache[\"eu\"].aws_elasticache_cluster.this[\"primary\"].cache_nodes": []interface{}{
+			map[string]interface{}{"address": "cache.internal"},
+		},
+		"aws_db_instance.main": map[string]interface{}{
+			"address": "db.internal",
+			"port":    json.Number("5432"),
+		},
+	}
+	for key, expected := range testCases {
+		val, err := backend.GetIndividualSecret("state", key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(val, expected) {
+			t.Fatalf("%s expected to be %v but received %v", key, expected, val)
+		}
+	}
+}
+
+func TestTerraformStateSensitive(t *testing.T) {
+	state := `{
+		"version": 4,
+		"outputs": {
+			"db_host": {"value": "db.internal", "type": "string"},
+			"db_password": {"value": "s3cr3t", "type": "string", "sensitive": true}
+		},
+		"resources": [
+			{
+				"mode": "managed", "type": "aws_db_instance", "name": "main",
+				"instances": [{
+					"attributes": {"address": "db.internal", "password": "s3cr3t"},
+					"sensitive_attributes": [[{"type": "get_attr", "value": "password"}]]
+				}]
+			},
+			{
+				"mode": "managed", "type": "random_password", "name": "api",
+				"instances": [{
+					"attributes": {"id": "none", "result": "t0k3n"},
+					"sensitive_attributes": "unknown format"
+				}]
+			}
+		]
+	}`
+	mock := newMockMinioClient()
+	mock.setObject("argocd-test", "state", []byte(state))
+	backend := backends.NewS3Backend(mock, "argocd-test", "", nil, nil)
+
+	testCases := map[string]bool{
+		"db_host":                       false,
+		"db_password":                   true,
+		"aws_db_instance.main.address":  false,
+		"aws_db_instance.main.password": true,
+		"aws_db_instance.main":          true,
+		"random_password.api.id":        true,
+	}
+	for key, sensitive := range testCases {
+		val, err := backend.GetIndividualSecret("state", key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := val.(types.SensitiveValue); ok != sensitive {
+			t.Fatalf("%s expected to be sensitive: %v but received %v", key, sensitive, val)
+		}
+	}
+}
+
+func TestTerraformStateTypes(t *testing.T) {
+	state := `{
+		"version": 4,
+		"outputs": {
+			"account_id": {"value": 123456789012345678, "type": "number"},
+			"ratio": {"value": 0.25, "type": "number"},
+			"port": {"value": "5432", "type": "number"},
+			"zone_id": {"value": 1234500000, "type": "string"},
+			"enabled": {"value": "true", "type": "bool"},
+			"ports": {"value": {"http": 80, "https": "443"}, "type": ["map", "number"]},
+			"endpoint": {"value": {"host": "db", "port": 5432, "tags": [1, 2]}, "type": ["object", {"host": "string", "port": "string", "tags": ["list", "string"]}]},
+			"pair": {"value": ["a", 1], "type": ["tuple", ["string", "string"]]},
+			"untyped": {"value": 1e3}
+		}
+	}`
+	mock := newMockMinioClient()
+	mock.setObject("argocd-test", "state", []byte(state))
+	backend := backends.NewS3Backend(mock, "argocd-test", "", nil, nil)
+
+	testCases := map[string]interface{}{
+		"account_id": json.Number("123456789012345678"),
+		"ratio":      json.Number("0.25"),
+		"port":       json.Number("5432"),
+		"zone_id":    "1234500000",
+		"enabled":    true,
+		"ports": map[string]interface{}{
+			"http":  json.Number("80"),
+			"https": json.Number("443"),
+		},
+		"endpoint": map[string]interface{}{
+			"host": "db",
+			"port": "5432",
+			"tags": []interface{}{"1", "2"},
+		},
+		"pair":    []interface{}{"a", "1"},
+		"untyped": json.Number("1e3"),
+	}
+	for key, expected := range testCases {
+		val, err := backend.GetIndividualSecret("state", key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(val, expected) {
+			t.Fatalf("%s expected to be %#v but received %#v", key, expected, val)
+		}
+	}
+}
+
+func TestTerraformStateValidation(t *testing.T) {
+	mock := newMockMinioClient()
+	mock.setObject("argocd-test", "current", []byte(`{
+		"version": 4,
+		"terraform_version": "1.3.2",
+		"serial": 12,
+		"lineage": "3f1a6a46-6f1b-4e8a-9f0a-1c1d2e3f4a5b",
+		"outputs": {"vpc_id": {"value": "vpc-123"}}
+	}`))
+	mock.setObject("argocd-test", "legacy", []byte(`{"version": 3, "terraform_version": "0.11.14", "modules": []}`))
+	mock.setObject("argocd-test", "invalid", []byte(`{"version": 4, "terraform_version": "latest", "outputs": {}}`))
+	backend := backends.NewS3Backend(mock, "argocd-test", "", nil, nil)
+
+	testCases := []struct {
+		name        string
+		path        string
+		annotations map[string]string
+		valid       bool
+	}{
+		{"current state", "current", nil, true},
+		{"matching lineage", "current", map[string]string{types.ATPLineageAnnotation: "3f1a6a46-6f1b-4e8a-9f0a-1c1d2e3f4a5b"}, true},
+		{"different lineage", "current", map[string]string{types.ATPLineageAnnotation: "0b6d3c2a-other"}, false},
+		{"serial at minimum", "current", map[string]string{types.ATPMinSerialAnnotation: "12"}, true},
+		{"serial below minimum", "current", map[string]string{types.ATPMinSerialAnnotation: "13"}, false},
+		{"invalid minimum serial", "current", map[string]string{types.ATPMinSerialAnnotation: "latest"}, false},
+		{"legacy state version", "legacy", nil, false},
+		{"invalid terraform version", "invalid", nil, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := backend.GetSecrets(tc.path, tc.annotations)
+			if tc.valid && err != nil {
+				t.Fatalf("expected the state to be valid but got %s", err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected the state to be rejected")
+			}
+		})
+	}
+}
+
+// sseMinioClient serves a single object encrypted with an SSE-C key, rejecting requests without the key like S3
+type sseMinioClient struct {
+	data []byte
+	key  string
+}
+
+func (m *sseMinioClient) GetObject(_ context.Context, _, _ string, opt minio.GetObjectOptions) (io.Reader, error) {
+	header := opt.Header()
+	if header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm") != "AES256" ||
+		header.Get("X-Amz-Server-Side-Encryption-Customer-Key") != m.key {
+		return nil, fmt.Errorf("the object was stored using a form of server side encryption")
+	}
+	return bytes.NewReader(m.data), nil
+}
+
+func TestTerraformStateSSECustomerKey(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+	sse, err := encrypt.NewSSEC(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock := &sseMinioClient{
+		data: []byte(`{"version": 4, "outputs": {"vpc_id": {"value": "vpc-123"}}}`),
+		key:  base64.StdEncoding.EncodeToString(key),
+	}
+
+	cacheDir := t.TempDir()
+	cache := backends.NewDiskCache(cacheDir, time.Hour)
+	val, err := backends.NewS3Backend(mock, "argocd-test", "", cache, sse).GetIndividualSecret("state", "vpc_id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "vpc-123" {
+		t.Fatalf("vpc_id expected to be vpc-123 but received %v", val)
+	}
+
+	// The decrypted state must not end up on disk
+	cached, err := ioutil.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 0 {
+		t.Fatalf("expected no states cached on disk but found %d files", len(cached))
+	}
+
+	if _, err := backends.NewS3Backend(mock, "argocd-test", "", nil, nil).GetSecrets("state", nil); err == nil {
+		t.Fatal("expected an error reading an SSE-C object without its key")
+	}
 }
@@ -0,0 +1,80 @@
+package backends
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// typedValue converts a decoded `value` to the terraform type of an output, which is encoded like
+// `"number"`, `["list", "string"]` or `["object", {"port": "number"}]`. It follows the conversions terraform
+// itself allows between primitive types, so e.g. a `string` output always renders as a string.
+// Values which don't match their type, and values without a type, are returned as they are
+func typedValue(value interface{}, tfType interface{}) interface{} {
+	switch tfType := tfType.(type) {
+	case string:
+		return primitiveValue(value, tfType)
+	case []interface{}:
+		if len(tfType) < 2 {
+			return value
+		}
+		kind, _ := tfType[0].(string)
+		switch kind {
+		case "list", "set":
+			if list, ok := value.([]interface{}); ok {
+				for idx, elem := range list {
+					list[idx] = typedValue(elem, tfType[1])
+				}
+			}
+		case "tuple":
+			list, ok := value.([]interface{})
+			types, typesOk := tfType[1].([]interface{})
+			if ok && typesOk && len(list) == len(types) {
+				for idx, elem := range list {
+					list[idx] = typedValue(elem, types[idx])
+				}
+			}
+		case "map":
+			if object, ok := value.(map[string]interface{}); ok {
+				for key, elem := range object {
+					object[key] = typedValue(elem, tfType[1])
+				}
+			}
+		case "object":
+			object, ok := value.(map[string]interface{})
+			types, typesOk := tfType[1].(map[string]interface{})
+			if ok && typesOk {
+				for key, elem := range object {
+					object[key] = typedValue(elem, types[key])
+				}
+			}
+		}
+	}
+
+	return value
+}
+
+func primitiveValue(value interface{}, tfType string) interface{} {
+	switch tfType {
+	case "string":
+		switch value := value.(type) {
+		case json.Number:
+			return string(value)
+		case bool:
+			return strconv.FormatBool(value)
+		}
+	case "number":
+		if value, ok := value.(string); ok {
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				return json.Number(value)
+			}
+		}
+	case "bool":
+		if value, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(value); err == nil {
+				return b
+			}
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,121 @@
+package backends
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// VaultDefaultKVVersion is the KV secrets engine version paths are read with by default
+	VaultDefaultKVVersion = "2"
+)
+
+// VaultBackend is a struct for reading secrets of a Vault KV v1 or v2 secrets engine, so `<path:...>`
+// placeholders resolve along with terraform outputs
+type VaultBackend struct {
+	client    *api.Client
+	auth      types.AuthType
+	mount     string
+	kvVersion string
+}
+
+// NewVaultBackend initializes a new Vault KV backend reading paths below `mount` with `kvVersion`,
+// after logging in with `auth`. KV v2 paths include the `data/` segment, like `secret/data/database`
+func NewVaultBackend(client *api.Client, auth types.AuthType, mount, kvVersion string) *VaultBackend {
+	return &VaultBackend{
+		client:    client,
+		auth:      auth,
+		mount:     strings.Trim(mount, "/"),
+		kvVersion: kvVersion,
+	}
+}
+
+// Login logs in Vault, reusing the token cached by a previous run while it's valid
+func (v *VaultBackend) Login() error {
+	return vaultLogin(v.client, v.auth)
+}
+
+// GetSecrets gets the secrets at `path`. The atp.kubernetes.io/version annotation reads a version of a
+// KV v2 secret, and the atp.kubernetes.io/kv-version annotation overrides the KV version of the backend
+func (v *VaultBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	if err := unsupportedChecks("vault", annotations); err != nil {
+		return nil, err
+	}
+
+	kvVersion := v.kvVersion
+	if version := annotations[types.ATPKVVersionAnnotation]; version != "" {
+		kvVersion = version
+	}
+	version := annotations[types.ATPVersionAnnotation]
+	path = v.mount + "/" + strings.Trim(path, "/")
+
+	var secret *api.Secret
+	var err error
+	switch kvVersion {
+	case "1":
+		if version != "" {
+			return nil, fmt.Errorf("KV v1 secrets are not versioned, received version %s for %s", version, path)
+		}
+		utils.VerboseToStdErr("Hashicorp Vault reading KV v1 secret %s", path)
+		secret, err = v.client.Logical().Read(path)
+	case "2":
+		var params map[string][]string
+		if version != "" {
+			params = map[string][]string{"version": {version}}
+		}
+		utils.VerboseToStdErr("Hashicorp Vault reading KV v2 secret %s at version %q", path, version)
+		secret, err = v.client.Logical().ReadWithData(path, params)
+	default:
+		return nil, fmt.Errorf("unsupported KV version %s, only versions 1 and 2 are supported", kvVersion)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault secret %s: %w", path, err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("no vault secret found at %s", path)
+	}
+
+	data := secret.Data
+	if kvVersion != "1" {
+		// Deleted and destroyed versions keep their metadata without data
+		var ok bool
+		data, ok = secret.Data["data"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("no data in vault secret %s, make sure the path includes the data/ segment of KV v2", path)
+		}
+	}
+
+	// Everything kept in Vault is a secret, so it's only rendered into Secrets unless a manifest allows it
+	secrets := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		secrets[key] = types.SensitiveValue{Value: value}
+	}
+
+	return secrets, nil
+}
+
+// GetIndividualSecret will get the specific secret (placeholder) from the secrets at `path`
+func (v *VaultBackend) GetIndividualSecret(path, key string, annotations map[string]string) (interface{}, error) {
+	secrets, err := v.GetSecrets(path, annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	return individualSecret(secrets, path, key)
+}
+
+// vaultLogin reuses the token cached by a previous run while it's valid, and authenticates with `auth` otherwise
+func vaultLogin(client *api.Client, auth types.AuthType) error {
+	token := client.Token()
+	if err := utils.CheckExistingToken(client); err == nil {
+		return nil
+	}
+	// An invalid cached token replaced the one of the client, e.g. VAULT_TOKEN for token auth
+	client.SetToken(token)
+
+	return auth.Authenticate(client)
+}
@@ -0,0 +1,88 @@
+package backends_test
+
+import (
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/auth/vault"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/helpers"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+)
+
+func TestVaultBackend(t *testing.T) {
+	// Unlike CreateTestVault, its kv mount is served by the KV v2 plugin, with two versions of kv/data/versioned
+	cluster, _, _ := helpers.CreateTestUserPassVault(t)
+	defer cluster.Cleanup()
+
+	client := cluster.Cores[0].Client
+	secrets := []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"kv/data/test", map[string]interface{}{"data": map[string]interface{}{"hello": "world"}}},
+		{"secret/foo", map[string]interface{}{"secret": "bar"}},
+	}
+	for _, secret := range secrets {
+		if _, err := client.Logical().Write(secret.path, secret.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kv := backends.NewVaultBackend(client, &vault.TokenAuth{}, "kv", backends.VaultDefaultKVVersion)
+	secret := backends.NewVaultBackend(client, &vault.TokenAuth{}, "secret", "1")
+	if err := kv.Login(); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name        string
+		backend     *backends.VaultBackend
+		path        string
+		key         string
+		annotations map[string]string
+		expected    interface{}
+	}{
+		{"kv v2", kv, "data/test", "hello", nil, "world"},
+		{"kv v2 latest version", kv, "data/versioned", "secret", nil, "version2"},
+		{"kv v2 pinned version", kv, "/data/versioned", "secret", map[string]string{types.ATPVersionAnnotation: "1"}, "version1"},
+		{"kv v1", secret, "foo", "secret", nil, "bar"},
+		{"kv version annotation", kv, "../secret/foo", "secret", map[string]string{types.ATPKVVersionAnnotation: "1"}, "bar"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			val, err := tc.backend.GetIndividualSecret(tc.path, tc.key, tc.annotations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if val != (types.SensitiveValue{Value: tc.expected}) {
+				t.Fatalf("%s expected to be %v but received %v", tc.key, tc.expected, val)
+			}
+		})
+	}
+
+	failures := []struct {
+		name        string
+		backend     *backends.VaultBackend
+		path        string
+		annotations map[string]string
+	}{
+		{"missing secret", kv, "data/missing", nil},
+		{"kv v2 path without data segment", kv, "test", nil},
+		{"kv v1 version", secret, "foo", map[string]string{types.ATPVersionAnnotation: "1"}},
+		{"unsupported kv version", secret, "foo", map[string]string{types.ATPKVVersionAnnotation: "3"}},
+		{"lineage", kv, "data/test", map[string]string{types.ATPLineageAnnotation: "lineage"}},
+	}
+	for _, tc := range failures {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.backend.GetSecrets(tc.path, tc.annotations); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	t.Run("missing key", func(t *testing.T) {
+		if _, err := kv.GetIndividualSecret("data/test", "missing", nil); err == nil {
+			t.Fatal("expected an error for a missing key")
+		}
+	})
+}
@@ -2,18 +2,95 @@ package config
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/auth/vault"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/kube"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+	"github.com/hashicorp/vault/api"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// The settings selecting the server and credentials of a backend. Apps sharing a repo server and its
+// ATP_CACHE_DIR only share cached states when all of them are equal
+var (
+	vaultCacheIdentity = []string{
+		"VAULT_ADDR",
+		"VAULT_NAMESPACE",
+		"VAULT_TOKEN",
+		types.EnvAtpAuthType,
+		types.EnvAtpGithubToken,
+		types.EnvAtpRoleID,
+		types.EnvAtpSecretID,
+		types.EnvAtpUsername,
+		types.EnvAtpPassword,
+		types.EnvAtpMountPath,
+		types.EnvAtpK8sMountPath,
+		types.EnvAtpK8sRole,
+		types.EnvAtpK8sTokenPath,
+	}
+	s3CacheIdentity = append([]string{
+		types.EnvAtpS3Endpoint,
+		types.EnvAtpS3CredentialsProvider,
+		types.EnvAtpS3AccessKey,
+		types.EnvAtpS3SecretKey,
+		types.EnvAtpS3CredentialsFile,
+		types.EnvAtpS3Profile,
+		types.EnvAtpS3RoleARN,
+		types.EnvAtpS3WebIdentityToken,
+		types.EnvAtpS3STSEndpoint,
+		types.EnvAtpS3AssumeRoleARN,
+		types.EnvAtpS3AssumeRoleExternal,
+		types.EnvAtpS3VaultPath,
+		types.EnvAWSRoleARN,
+		types.EnvAWSWebIdentityTokenFile,
+		"AWS_ACCESS_KEY_ID",
+		"AWS_ACCESS_KEY",
+		"AWS_SECRET_ACCESS_KEY",
+		"AWS_SECRET_KEY",
+		"AWS_SESSION_TOKEN",
+		"AWS_SHARED_CREDENTIALS_FILE",
+		"AWS_PROFILE",
+	}, vaultCacheIdentity...)
+	httpCacheIdentity = []string{
+		types.EnvAtpHTTPUsername,
+		types.EnvAtpHTTPPassword,
+		types.EnvAtpHTTPHeaders,
+	}
+	azureRMCacheIdentity = []string{
+		types.EnvAtpAzureRMStorageAccount,
+		types.EnvAtpAzureRMEndpoint,
+		types.EnvAtpAzureRMAccessKey,
+		types.EnvAtpAzureRMSASToken,
+		types.EnvAzureAuthorityHost,
+		types.EnvAzureTenantID,
+		types.EnvAzureClientID,
+		types.EnvAzureFederatedTokenFile,
+	}
+	gcsCacheIdentity = []string{
+		types.EnvAtpGCSEndpoint,
+		types.EnvAtpGCSCredentials,
+		"GOOGLE_APPLICATION_CREDENTIALS",
+	}
 )
 
 // Options options that can be passed to a Config struct
@@ -24,9 +101,14 @@ type Options struct {
 
 // Config is used to decide the backend and auth type
 type Config struct {
-	Backend types.Backend
+	Backend         types.Backend
+	PrefetchWorkers int
 }
 
+const (
+	defaultPrefetchWorkers = 8
+)
+
 // todo: remote it
 var backendPrefixes []string = []string{
 	"vault",
@@ -41,6 +123,18 @@ var backendPrefixes []string = []string{
 func New(v *viper.Viper, co *Options) (*Config, error) {
 
 	v.SetDefault(types.EnvAtpBackend, types.S3Backend)
+	v.SetDefault(types.EnvAtpPrefetchWorkers, defaultPrefetchWorkers)
+	v.SetDefault(types.EnvAtpS3WorkspaceKeyPrefix, backends.S3DefaultWorkspaceKeyPrefix)
+	v.SetDefault(types.EnvAtpS3BucketLookup, types.S3BucketLookupAuto)
+	v.SetDefault(types.EnvAtpS3CredentialsProvider, types.S3CredentialsStatic)
+	v.SetDefault(types.EnvAtpS3STSEndpoint, backends.S3DefaultSTSEndpoint)
+	v.SetDefault(types.EnvAtpS3STSRegion, backends.S3DefaultSTSRegion)
+	v.SetDefault(types.EnvAtpLocalRoot, ".")
+	v.SetDefault(types.EnvAtpOutputsRoot, ".")
+	v.SetDefault(types.EnvAtpGCSEndpoint, backends.GCSDefaultEndpoint)
+	v.SetDefault(types.EnvAtpConsulAddress, backends.ConsulDefaultAddress)
+	v.SetDefault(types.EnvAtpTFEAddress, backends.RemoteDefaultAddress)
+	v.SetDefault(types.EnvAtpKVVersion, backends.VaultDefaultKVVersion)
 	// Read in config file or kubernetes secret and set as env vars
 	err := readConfigOrSecret(co.SecretName, co.ConfigPath, v)
 	if err != nil {
@@ -56,45 +150,616 @@ func New(v *viper.Viper, co *Options) (*Config, error) {
 		utils.VerboseToStdErr("%s: %s\n", k, viperValue)
 	}
 
-	var backend types.Backend
+	encryption, err := newStateEncryption(v)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := newBackend(v.GetString(types.EnvAtpBackend), v)
+	if err != nil {
+		return nil, err
+	}
+	setStateEncryption(backend, encryption)
+
+	return &Config{
+		Backend:         newRouter(backend, v, encryption),
+		PrefetchWorkers: v.GetInt(types.EnvAtpPrefetchWorkers),
+	}, nil
+}
 
-	switch v.GetString(types.EnvAtpBackend) {
+// newBackend returns the backend of type `backendType` configured by `v`
+func newBackend(backendType string, v *viper.Viper) (types.Backend, error) {
+	switch backendType {
 	case types.S3Backend:
-		{
-			if !v.IsSet(types.EnvAtpS3AccessKey) ||
-				!v.IsSet(types.EnvAtpS3Bucket) ||
-				!v.IsSet(types.EnvAtpS3Endpoint) ||
-				!v.IsSet(types.EnvAtpS3SecretKey) {
-				return nil, fmt.Errorf(
-					"%s, %s, %s and %s are required for terraform state backend",
-					types.EnvAtpS3AccessKey,
-					types.EnvAtpS3Bucket,
-					types.EnvAtpS3Endpoint,
-					types.EnvAtpS3SecretKey,
-				)
-			}
+		if !v.IsSet(types.EnvAtpS3Bucket) {
+			return nil, fmt.Errorf("%s is required for terraform state backend", types.EnvAtpS3Bucket)
+		}
+		return newS3Backend(v, v.GetString(types.EnvAtpS3Bucket))
+	case types.LocalBackend:
+		return backends.NewLocalBackend(v.GetString(types.EnvAtpLocalRoot)), nil
+	case types.OutputsBackend:
+		return backends.NewOutputsBackend(v.GetString(types.EnvAtpOutputsRoot)), nil
+	case types.HTTPBackend:
+		if !v.IsSet(types.EnvAtpHTTPAddress) {
+			return nil, fmt.Errorf("%s is required for terraform http state backend", types.EnvAtpHTTPAddress)
+		}
+		return newHTTPBackend(v, v.GetString(types.EnvAtpHTTPAddress))
+	case types.GCSBackend:
+		if !v.IsSet(types.EnvAtpGCSBucket) {
+			return nil, fmt.Errorf("%s is required for terraform gcs state backend", types.EnvAtpGCSBucket)
+		}
+		return newGCSBackend(v, v.GetString(types.EnvAtpGCSBucket))
+	case types.AzureRMBackend:
+		if !v.IsSet(types.EnvAtpAzureRMContainer) {
+			return nil, fmt.Errorf("%s is required for terraform azurerm state backend", types.EnvAtpAzureRMContainer)
+		}
+		return newAzureRMBackend(v, v.GetString(types.EnvAtpAzureRMContainer))
+	case types.ConsulBackend:
+		return newConsulBackend(v, v.GetString(types.EnvAtpConsulDatacenter))
+	case types.PGBackend:
+		if !v.IsSet(types.EnvAtpPGConnStr) {
+			return nil, fmt.Errorf("%s is required for terraform pg state backend", types.EnvAtpPGConnStr)
+		}
 
-			client, err := minio.New(v.GetString(types.EnvAtpS3Endpoint), &minio.Options{
-				Creds: credentials.NewStaticV4(
-					v.GetString(types.EnvAtpS3AccessKey),
-					v.GetString(types.EnvAtpS3SecretKey),
-					""),
-				Secure: v.GetBool(types.EnvAtpS3UseSSL),
-			})
+		db, err := sql.Open("postgres", v.GetString(types.EnvAtpPGConnStr))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open postgres connection: %w", err)
+		}
 
+		return backends.NewPGBackend(backends.WrapPGDB(db)), nil
+	case types.KubernetesBackend:
+		client, err := kube.NewClient()
+		if err != nil {
+			return nil, err
+		}
+
+		return backends.NewKubernetesBackend(client), nil
+	case types.RemoteBackend, types.CloudBackend:
+		return newRemoteBackend(v, v.GetString(types.EnvAtpTFEOrganization))
+	default:
+		return nil, fmt.Errorf("Must provide a supported Vault Type, received %s", backendType)
+	}
+}
+
+// newRouter returns a Router sending paths without a scheme to `fallback`, while scheme-qualified
+// paths are served by backends built from the same configuration with the host of the path, e.g.
+// `s3://bucket/key` reads `key` from `bucket` with the S3 settings of `v`
+func newRouter(fallback types.Backend, v *viper.Viper, encryption *backends.StateEncryption) *backends.Router {
+	router := backends.NewRouter(fallback)
+	register := func(scheme string, factory backends.BackendFactory) {
+		router.Register(scheme, func(host string) (types.Backend, error) {
+			backend, err := factory(host)
 			if err != nil {
-				return nil, fmt.Errorf("failed to create minio client: %w", err)
+				return nil, err
 			}
+			setStateEncryption(backend, encryption)
+			return backend, nil
+		})
+	}
 
-			backend = backends.NewS3Backend(backends.WrapMinioClient(client), v.GetString(types.EnvAtpS3Bucket))
+	register(types.S3Backend, func(bucket string) (types.Backend, error) {
+		return newS3Backend(v, bucket)
+	})
+	register(types.GCSBackend, func(bucket string) (types.Backend, error) {
+		return newGCSBackend(v, bucket)
+	})
+	register(types.AzureRMBackend, func(container string) (types.Backend, error) {
+		return newAzureRMBackend(v, container)
+	})
+	register(types.FileScheme, func(dir string) (types.Backend, error) {
+		return backends.NewLocalBackend(filepath.Join(v.GetString(types.EnvAtpLocalRoot), filepath.Clean(string(filepath.Separator)+dir))), nil
+	})
+	register(types.OutputsBackend, func(dir string) (types.Backend, error) {
+		return backends.NewOutputsBackend(filepath.Join(v.GetString(types.EnvAtpOutputsRoot), filepath.Clean(string(filepath.Separator)+dir))), nil
+	})
+	for _, scheme := range []string{types.HTTPScheme, types.HTTPSScheme} {
+		scheme := scheme
+		register(scheme, func(host string) (types.Backend, error) {
+			address := fmt.Sprintf("%s://%s", scheme, host)
+			// The credentials and headers of ATP_HTTP_* are only ever sent to the server they are configured for,
+			// manifests must not be able to send them, or any request at all, to a server of their choosing
+			if err := checkHTTPServer(v, address); err != nil {
+				return nil, err
+			}
+			return newHTTPBackend(v, address)
+		})
+	}
+	register(types.ConsulBackend, func(datacenter string) (types.Backend, error) {
+		if datacenter == "" {
+			datacenter = v.GetString(types.EnvAtpConsulDatacenter)
 		}
+		return newConsulBackend(v, datacenter)
+	})
+	for _, scheme := range []string{types.RemoteBackend, types.CloudBackend} {
+		register(scheme, func(organization string) (types.Backend, error) {
+			if organization == "" {
+				organization = v.GetString(types.EnvAtpTFEOrganization)
+			}
+			return newRemoteBackend(v, organization)
+		})
+	}
+	// Vault is opt-in, `<path:...>` placeholders are left for argocd-vault-plugin otherwise. ATP_AUTH_TYPE alone
+	// doesn't opt in, as it's also set for S3 credentials read from Vault
+	if !v.GetBool(types.EnvAtpVaultPlaceholders) {
+		return router
+	}
+	// The backends of every mount share one client and its token. The router builds them one at a time
+	var vaultClient *api.Client
+	var vaultAuth types.AuthType
+	register(types.VaultScheme, func(mount string) (types.Backend, error) {
+		if vaultClient == nil {
+			client, auth, err := newVaultClient(v)
+			if err != nil {
+				return nil, err
+			}
+			vaultClient, vaultAuth = client, auth
+		}
+		return backends.NewVaultBackend(vaultClient, vaultAuth, mount, v.GetString(types.EnvAtpKVVersion)), nil
+	})
+
+	return router
+}
+
+func newS3Backend(v *viper.Viper, bucket string) (types.Backend, error) {
+	if !v.IsSet(types.EnvAtpS3Endpoint) {
+		return nil, fmt.Errorf("%s is required for terraform state backend", types.EnvAtpS3Endpoint)
+	}
+
+	lookup, err := newS3BucketLookup(v.GetString(types.EnvAtpS3BucketLookup))
+	if err != nil {
+		return nil, err
+	}
+	transport, err := newS3Transport(v)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := newS3Credentials(v, &http.Client{
+		Timeout:   time.Minute,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := minio.New(v.GetString(types.EnvAtpS3Endpoint), &minio.Options{
+		Creds:        creds,
+		Secure:       v.GetBool(types.EnvAtpS3UseSSL),
+		Region:       v.GetString(types.EnvAtpS3Region),
+		BucketLookup: lookup,
+		Transport:    transport,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create minio client: %w", err)
+	}
+
+	sse, err := newS3SSECustomerKey(v)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := newDiskCache(v).Scoped(cacheIdentity(v, s3CacheIdentity)...)
+	return backends.NewS3Backend(backends.WrapMinioClient(client), bucket, v.GetString(types.EnvAtpS3WorkspaceKeyPrefix), cache, sse), nil
+}
+
+// newS3BucketLookup returns how minio addresses buckets, in the path or in the host name
+func newS3BucketLookup(lookup string) (minio.BucketLookupType, error) {
+	switch lookup {
+	case types.S3BucketLookupAuto:
+		return minio.BucketLookupAuto, nil
+	case types.S3BucketLookupPath:
+		return minio.BucketLookupPath, nil
+	case types.S3BucketLookupVirtualHost:
+		return minio.BucketLookupDNS, nil
 	default:
-		return nil, fmt.Errorf("Must provide a supported Vault Type, received %s", v.GetString(types.EnvAtpBackend))
+		return minio.BucketLookupAuto, fmt.Errorf("unsupported %s %s", types.EnvAtpS3BucketLookup, lookup)
 	}
+}
 
-	return &Config{
-		Backend: backend,
-	}, nil
+// newS3Transport returns the minio default transport trusting the CA bundle of ATP_S3_CA_FILE, and sending requests through
+// the proxy of ATP_S3_PROXY. Without an explicit proxy, the proxy of the environment like HTTPS_PROXY is used
+func newS3Transport(v *viper.Viper) (*http.Transport, error) {
+	transport, err := minio.DefaultTransport(true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create minio transport: %w", err)
+	}
+
+	if caFile := v.GetString(types.EnvAtpS3CAFile); caFile != "" {
+		transport.TLSClientConfig.RootCAs, err = utils.CertPoolWithCA(caFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if proxy := v.GetString(types.EnvAtpS3Proxy); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", types.EnvAtpS3Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return transport, nil
+}
+
+// newS3Credentials returns the credentials of the provider selected by `v`, used to assume another role
+// when ATP_S3_ASSUME_ROLE_ARN is set. STS requests are sent with `httpClient`
+func newS3Credentials(v *viper.Viper, httpClient *http.Client) (*credentials.Credentials, error) {
+	var creds *credentials.Credentials
+	switch provider := v.GetString(types.EnvAtpS3CredentialsProvider); provider {
+	case types.S3CredentialsStatic:
+		if !v.IsSet(types.EnvAtpS3AccessKey) || !v.IsSet(types.EnvAtpS3SecretKey) {
+			return nil, fmt.Errorf(
+				"%s and %s are required for %s credentials of terraform state backend",
+				types.EnvAtpS3AccessKey,
+				types.EnvAtpS3SecretKey,
+				provider,
+			)
+		}
+		creds = credentials.NewStaticV4(v.GetString(types.EnvAtpS3AccessKey), v.GetString(types.EnvAtpS3SecretKey), "")
+	case types.S3CredentialsEnv:
+		creds = credentials.NewEnvAWS()
+	case types.S3CredentialsProfile:
+		creds = credentials.NewFileAWSCredentials(v.GetString(types.EnvAtpS3CredentialsFile), v.GetString(types.EnvAtpS3Profile))
+	case types.S3CredentialsMetadata:
+		// Link-local metadata endpoints are never reached through the proxy
+		creds = credentials.NewIAM("")
+	case types.S3CredentialsWebIdentity:
+		roleARN := v.GetString(types.EnvAtpS3RoleARN)
+		if roleARN == "" {
+			roleARN = v.GetString(types.EnvAWSRoleARN)
+		}
+		tokenFile := v.GetString(types.EnvAtpS3WebIdentityToken)
+		if tokenFile == "" {
+			tokenFile = v.GetString(types.EnvAWSWebIdentityTokenFile)
+		}
+		if roleARN == "" || tokenFile == "" {
+			return nil, fmt.Errorf(
+				"%s and %s, or %s and %s of IRSA, are required for %s credentials of terraform state backend",
+				types.EnvAtpS3RoleARN,
+				types.EnvAtpS3WebIdentityToken,
+				types.EnvAWSRoleARN,
+				types.EnvAWSWebIdentityTokenFile,
+				provider,
+			)
+		}
+		creds = backends.NewS3WebIdentity(httpClient, v.GetString(types.EnvAtpS3STSEndpoint), roleARN, tokenFile)
+	case types.S3CredentialsChain:
+		// Like the AWS SDKs: environment, shared credentials file, then web identity or EC2/ECS metadata
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	case types.S3CredentialsVault:
+		if !v.IsSet(types.EnvAtpS3VaultPath) {
+			return nil, fmt.Errorf("%s is required for %s credentials of terraform state backend", types.EnvAtpS3VaultPath, provider)
+		}
+		client, auth, err := newVaultClient(v)
+		if err != nil {
+			return nil, err
+		}
+		creds = backends.NewS3VaultCredentials(client, auth, v.GetString(types.EnvAtpS3VaultPath))
+	default:
+		return nil, fmt.Errorf("unsupported %s %s", types.EnvAtpS3CredentialsProvider, provider)
+	}
+
+	if v.GetString(types.EnvAtpS3AssumeRoleARN) == "" {
+		return creds, nil
+	}
+
+	return backends.NewS3AssumeRole(
+		httpClient,
+		creds,
+		v.GetString(types.EnvAtpS3STSEndpoint),
+		v.GetString(types.EnvAtpS3STSRegion),
+		v.GetString(types.EnvAtpS3AssumeRoleARN),
+		v.GetString(types.EnvAtpS3AssumeRoleSession),
+		v.GetString(types.EnvAtpS3AssumeRoleExternal),
+	), nil
+}
+
+// newVaultClient returns a Vault client configured by the VAULT_ environment variables, and the authentication
+// selected by ATP_AUTH_TYPE it logs in with
+func newVaultClient(v *viper.Viper) (*api.Client, types.AuthType, error) {
+	auth, err := newVaultAuth(v)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create vault client: %w", err)
+	}
+
+	return client, auth, nil
+}
+
+// newVaultAuth returns the Vault authentication of type ATP_AUTH_TYPE
+func newVaultAuth(v *viper.Viper) (types.AuthType, error) {
+	switch authType := v.GetString(types.EnvAtpAuthType); authType {
+	case types.ApproleAuth:
+		if !v.IsSet(types.EnvAtpRoleID) || !v.IsSet(types.EnvAtpSecretID) {
+			return nil, fmt.Errorf("%s and %s are required for vault %s auth", types.EnvAtpRoleID, types.EnvAtpSecretID, authType)
+		}
+		return vault.NewAppRoleAuth(v.GetString(types.EnvAtpRoleID), v.GetString(types.EnvAtpSecretID), v.GetString(types.EnvAtpMountPath)), nil
+	case types.GithubAuth:
+		if !v.IsSet(types.EnvAtpGithubToken) {
+			return nil, fmt.Errorf("%s is required for vault %s auth", types.EnvAtpGithubToken, authType)
+		}
+		return vault.NewGithubAuth(v.GetString(types.EnvAtpGithubToken), v.GetString(types.EnvAtpMountPath)), nil
+	case types.K8sAuth:
+		if !v.IsSet(types.EnvAtpK8sRole) {
+			return nil, fmt.Errorf("%s is required for vault %s auth", types.EnvAtpK8sRole, authType)
+		}
+		mountPath := v.GetString(types.EnvAtpK8sMountPath)
+		if mountPath == "" {
+			mountPath = v.GetString(types.EnvAtpMountPath)
+		}
+		return vault.NewK8sAuth(v.GetString(types.EnvAtpK8sRole), mountPath, v.GetString(types.EnvAtpK8sTokenPath)), nil
+	case types.UserPassAuth:
+		if !v.IsSet(types.EnvAtpUsername) || !v.IsSet(types.EnvAtpPassword) {
+			return nil, fmt.Errorf("%s and %s are required for vault %s auth", types.EnvAtpUsername, types.EnvAtpPassword, authType)
+		}
+		return vault.NewUserPassAuth(v.GetString(types.EnvAtpUsername), v.GetString(types.EnvAtpPassword), v.GetString(types.EnvAtpMountPath)), nil
+	case types.TokenAuth:
+		return &vault.TokenAuth{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported %s %q for vault", types.EnvAtpAuthType, authType)
+	}
+}
+
+// newS3SSECustomerKey returns the SSE-C key states are encrypted with, or nil if none is configured.
+// Like `sse_customer_key` of the terraform s3 backend, the key is a base64 encoded 256 bit key
+func newS3SSECustomerKey(v *viper.Viper) (encrypt.ServerSide, error) {
+	encoded, err := valueOrFile(v, types.EnvAtpS3SSECustomerKey, types.EnvAtpS3SSECustomerKeyFile)
+	if err != nil || encoded == "" {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("%s must be base64 encoded: %w", types.EnvAtpS3SSECustomerKey, err)
+	}
+	sse, err := encrypt.NewSSEC(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", types.EnvAtpS3SSECustomerKey, err)
+	}
+
+	return sse, nil
+}
+
+func newHTTPBackend(v *viper.Viper, address string) (types.Backend, error) {
+	httpClient, err := utils.HttpClientWithCA(v.GetString(types.EnvAtpHTTPCAFile))
+	if err != nil {
+		return nil, err
+	}
+
+	return backends.NewHTTPBackend(
+		backends.NewDiskCachingClient(httpClient, newDiskCache(v).Scoped(cacheIdentity(v, httpCacheIdentity)...)),
+		address,
+		v.GetString(types.EnvAtpHTTPUsername),
+		v.GetString(types.EnvAtpHTTPPassword),
+		v.GetStringMapString(types.EnvAtpHTTPHeaders),
+	), nil
+}
+
+// checkHTTPServer returns an error unless `address` is on the server of ATP_HTTP_ADDRESS,
+// with the same scheme, host and port
+func checkHTTPServer(v *viper.Viper, address string) error {
+	if v.GetString(types.EnvAtpHTTPAddress) == "" {
+		return fmt.Errorf("%s is required to read states from %s", types.EnvAtpHTTPAddress, address)
+	}
+	configured, err := url.Parse(v.GetString(types.EnvAtpHTTPAddress))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", types.EnvAtpHTTPAddress, err)
+	}
+	requested, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", address, err)
+	}
+	if httpOrigin(configured) != httpOrigin(requested) {
+		return fmt.Errorf("%s is not the server of %s, states are only read from %s", address, types.EnvAtpHTTPAddress, httpOrigin(configured))
+	}
+
+	return nil
+}
+
+// httpOrigin returns the scheme, host and port of `u`, with the default port of the scheme if `u` has none
+func httpOrigin(u *url.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if scheme == types.HTTPSScheme {
+			port = "443"
+		}
+	}
+
+	return fmt.Sprintf("%s://%s:%s", scheme, strings.ToLower(u.Hostname()), port)
+}
+
+func newGCSBackend(v *viper.Viper, bucket string) (types.Backend, error) {
+	httpClient, err := newGCSClient(v.GetString(types.EnvAtpGCSCredentials))
+	if err != nil {
+		return nil, err
+	}
+
+	cache := newDiskCache(v).Scoped(cacheIdentity(v, gcsCacheIdentity)...)
+	return backends.NewGCSBackend(backends.NewDiskCachingClient(httpClient, cache), v.GetString(types.EnvAtpGCSEndpoint), bucket), nil
+}
+
+// newStateEncryption returns how encrypted states are decrypted, or nil if no passphrase or key is configured
+func newStateEncryption(v *viper.Viper) (*backends.StateEncryption, error) {
+	passphrase, err := valueOrFile(v, types.EnvAtpStatePassphrase, types.EnvAtpStatePassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	hexKey, err := valueOrFile(v, types.EnvAtpStateKey, types.EnvAtpStateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" && hexKey == "" {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+	if err != nil {
+		return nil, fmt.Errorf("%s must be hex encoded: %w", types.EnvAtpStateKey, err)
+	}
+
+	return backends.NewStateEncryption(passphrase, key)
+}
+
+// setStateEncryption sets `encryption` on backends reading raw states
+func setStateEncryption(backend types.Backend, encryption *backends.StateEncryption) {
+	if decoder, ok := backend.(interface {
+		SetStateEncryption(*backends.StateEncryption)
+	}); ok {
+		decoder.SetStateEncryption(encryption)
+	}
+}
+
+// valueOrFile returns the setting `key`, or the content of the file named by the setting `fileKey`
+// without its trailing newline, e.g. for a mounted Kubernetes Secret
+func valueOrFile(v *viper.Viper, key, fileKey string) (string, error) {
+	if v.GetString(key) != "" || v.GetString(fileKey) == "" {
+		return v.GetString(key), nil
+	}
+
+	data, err := ioutil.ReadFile(v.GetString(fileKey))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", fileKey, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// newDiskCache returns the cache for downloaded states, or nil if no cache directory is configured
+func newDiskCache(v *viper.Viper) *backends.DiskCache {
+	if v.GetString(types.EnvAtpCacheDir) == "" {
+		return nil
+	}
+
+	return backends.NewDiskCache(v.GetString(types.EnvAtpCacheDir), v.GetDuration(types.EnvAtpCacheTTL))
+}
+
+// cacheIdentity returns the settings `keys` with their values, which scope the disk cache of a backend
+// to the server and credentials states are read with
+func cacheIdentity(v *viper.Viper, keys []string) []string {
+	identity := make([]string, 0, len(keys))
+	for _, key := range keys {
+		// fmt prints maps like ATP_HTTP_HEADERS of a configuration file with sorted keys
+		identity = append(identity, fmt.Sprintf("%s=%v", key, v.Get(key)))
+	}
+
+	return identity
+}
+
+func newAzureRMBackend(v *viper.Viper, container string) (types.Backend, error) {
+	if !v.IsSet(types.EnvAtpAzureRMStorageAccount) {
+		return nil, fmt.Errorf("%s is required for terraform azurerm state backend", types.EnvAtpAzureRMStorageAccount)
+	}
+
+	account := v.GetString(types.EnvAtpAzureRMStorageAccount)
+	httpClient := utils.DefaultHttpClient()
+
+	var auth backends.AzureAuthorizer
+	var err error
+	switch {
+	case v.IsSet(types.EnvAtpAzureRMAccessKey):
+		auth, err = backends.NewAzureSharedKeyAuth(account, v.GetString(types.EnvAtpAzureRMAccessKey))
+	case v.IsSet(types.EnvAtpAzureRMSASToken):
+		auth, err = backends.NewAzureSASAuth(v.GetString(types.EnvAtpAzureRMSASToken))
+	case v.IsSet(types.EnvAzureFederatedTokenFile):
+		auth = backends.NewAzureWorkloadIdentityAuth(
+			httpClient,
+			v.GetString(types.EnvAzureAuthorityHost),
+			v.GetString(types.EnvAzureTenantID),
+			v.GetString(types.EnvAzureClientID),
+			v.GetString(types.EnvAzureFederatedTokenFile),
+		)
+	default:
+		err = fmt.Errorf(
+			"one of %s, %s or %s is required for terraform azurerm state backend",
+			types.EnvAtpAzureRMAccessKey,
+			types.EnvAtpAzureRMSASToken,
+			types.EnvAzureFederatedTokenFile,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := v.GetString(types.EnvAtpAzureRMEndpoint)
+	if endpoint == "" {
+		endpoint = backends.AzureBlobEndpoint(account)
+	}
+
+	cache := newDiskCache(v).Scoped(cacheIdentity(v, azureRMCacheIdentity)...)
+	return backends.NewAzureRMBackend(httpClient, endpoint, container, auth, cache), nil
+}
+
+func newConsulBackend(v *viper.Viper, datacenter string) (types.Backend, error) {
+	httpClient, err := utils.HttpClientWithClientCert(
+		v.GetString(types.EnvAtpConsulCAFile),
+		v.GetString(types.EnvAtpConsulCertFile),
+		v.GetString(types.EnvAtpConsulKeyFile),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return backends.NewConsulBackend(
+		httpClient,
+		v.GetString(types.EnvAtpConsulAddress),
+		v.GetString(types.EnvAtpConsulToken),
+		datacenter,
+	), nil
+}
+
+func newRemoteBackend(v *viper.Viper, organization string) (types.Backend, error) {
+	if !v.IsSet(types.EnvAtpTFEToken) {
+		return nil, fmt.Errorf("%s is required for terraform remote backend", types.EnvAtpTFEToken)
+	}
+
+	return backends.NewRemoteBackend(
+		utils.DefaultHttpClient(),
+		v.GetString(types.EnvAtpTFEAddress),
+		v.GetString(types.EnvAtpTFEToken),
+		organization,
+	), nil
+}
+
+// newGCSClient returns an http client authenticated with the service account key `credentials`,
+// given either as a path or as the JSON content. Without credentials Google's application default
+// credentials are used, which covers workload identity and GOOGLE_APPLICATION_CREDENTIALS
+func newGCSClient(credentials string) (*http.Client, error) {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, utils.DefaultHttpClient())
+	if credentials == "" {
+		client, err := google.DefaultClient(ctx, backends.GCSReadOnlyScope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find google default credentials: %w", err)
+		}
+		return client, nil
+	}
+
+	jsonKey := []byte(credentials)
+	if !strings.HasPrefix(strings.TrimSpace(credentials), "{") {
+		var err error
+		jsonKey, err = ioutil.ReadFile(credentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read google credentials: %w", err)
+		}
+	}
+
+	creds, err := google.CredentialsFromJSON(ctx, jsonKey, backends.GCSReadOnlyScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse google credentials: %w", err)
+	}
+
+	return oauth2.NewClient(ctx, creds.TokenSource), nil
 }
 
 func readConfigOrSecret(secretName, configPath string, v *viper.Viper) error {
@@ -35,16 +35,12 @@ func NewClient() (*Client, error) {
 // ReadSecret reads the specified Secret from the defined namespace, otherwise defaults to `argocd`
 // and returns a YAML []byte containing its data, decoded from base64
 func (c *Client) ReadSecret(name string) ([]byte, error) {
-	secretNamespace, secretName := secretNamespaceName(name)
-
-	utils.VerboseToStdErr("parsed secret name as %s from namespace %s", secretName, secretNamespace)
-
-	s, err := c.client.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	data, err := c.ReadSecretData(name)
 	if err != nil {
 		return nil, err
 	}
 	decoded := make(map[string]string)
-	for key, value := range s.Data {
+	for key, value := range data {
 		decoded[key] = string(value)
 	}
 	res, err := k8yaml.Marshal(&decoded)
@@ -53,3 +49,17 @@ func (c *Client) ReadSecret(name string) ([]byte, error) {
 	}
 	return res, nil
 }
+
+// ReadSecretData reads the specified Secret from the defined namespace, otherwise defaults to `argocd`
+// and returns its data, decoded from base64
+func (c *Client) ReadSecretData(name string) (map[string][]byte, error) {
+	secretNamespace, secretName := secretNamespaceName(name)
+
+	utils.VerboseToStdErr("parsed secret name as %s from namespace %s", secretName, secretNamespace)
+
+	s, err := c.client.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return s.Data, nil
+}
@@ -0,0 +1,116 @@
+package kube
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/utils"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// stateRef is a state read by a manifest, either through the path annotation or an inline-path placeholder
+type stateRef struct {
+	path        string
+	annotations map[string]string
+}
+
+// Prefetch reads the distinct states referenced by `manifests` from `backend` with up to `workers` concurrent reads.
+// It's meant to warm a caching backend before the manifests are replaced one after another, so failures are
+// only logged and left for the replacement to report
+func Prefetch(manifests []unstructured.Unstructured, backend types.Backend, workers int) {
+	refs := stateRefs(manifests, vaultPlaceholders(backend))
+	if workers < 1 {
+		workers = 1
+	}
+
+	utils.VerboseToStdErr("prefetching %d states with %d workers", len(refs), workers)
+	queue := make(chan stateRef)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ref := range queue {
+				_, err := backend.GetSecrets(ref.path, ref.annotations)
+				if err != nil {
+					utils.VerboseToStdErr("failed to prefetch state %s: %s", ref.path, err)
+				}
+			}
+		}()
+	}
+
+	for _, ref := range refs {
+		queue <- ref
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// stateRefs collects the distinct states read by manifests that aren't ignored, including Vault secrets if `vault` is set
+func stateRefs(manifests []unstructured.Unstructured, vault bool) []stateRef {
+	var refs []stateRef
+	seen := map[string]bool{}
+	add := func(path string, annotations map[string]string) {
+		// Only the workspace, version and KV version annotations select which state is read, the lineage and
+		// serial annotations are part of the cache key as they decide whether reading it fails
+		id := fmt.Sprintf("%s@%s#%s %s %s %s", path, annotations[types.ATPWorkspaceAnnotation], annotations[types.ATPVersionAnnotation],
+			annotations[types.ATPLineageAnnotation], annotations[types.ATPMinSerialAnnotation], annotations[types.ATPKVVersionAnnotation])
+		if !seen[id] {
+			seen[id] = true
+			refs = append(refs, stateRef{path: path, annotations: annotations})
+		}
+	}
+
+	for _, manifest := range manifests {
+		annotations := manifest.GetAnnotations()
+		if ignore, _ := strconv.ParseBool(annotations[types.ATPIgnoreAnnotation]); ignore {
+			continue
+		}
+
+		if path := annotations[types.ATPPathAnnotation]; path != "" {
+			add(workspacePath(path, annotations))
+		}
+
+		walkStrings(manifest.Object, func(value string) {
+			values := []string{value}
+			if manifest.GetKind() == "Secret" {
+				if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+					values = append(values, string(decoded))
+				}
+			}
+
+			for _, value := range values {
+				for _, match := range specificPathPlaceholder.FindAllString(value, -1) {
+					if keptPlaceholder(match, vault) {
+						continue
+					}
+					placeholder, _ := splitPlaceholder(match)
+					if path, _, stateAnnotations, ok := inlinePathState(placeholder, annotations); ok {
+						add(path, stateAnnotations)
+					}
+				}
+			}
+		})
+	}
+
+	return refs
+}
+
+// walkStrings calls `fn` with every string in `node`
+func walkStrings(node interface{}, fn func(string)) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for _, value := range node {
+			walkStrings(value, fn)
+		}
+	case []interface{}:
+		for _, value := range node {
+			walkStrings(value, fn)
+		}
+	case string:
+		fn(node)
+	}
+}
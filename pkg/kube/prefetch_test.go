@@ -0,0 +1,126 @@
+package kube
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// prefetchBackend records the states it was asked for
+type prefetchBackend struct {
+	mutex sync.Mutex
+	reads []string
+	vault bool
+}
+
+func (b *prefetchBackend) Serves(scheme string) bool {
+	return b.vault && scheme == types.VaultScheme
+}
+
+func (b *prefetchBackend) Login() error {
+	return nil
+}
+
+func (b *prefetchBackend) GetSecrets(path string, annotations map[string]string) (map[string]interface{}, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	id := fmt.Sprintf("%s@%s#%s", path, annotations[types.ATPWorkspaceAnnotation], annotations[types.ATPVersionAnnotation])
+	if kvVersion := annotations[types.ATPKVVersionAnnotation]; kvVersion != "" {
+		id += " kv" + kvVersion
+	}
+	b.reads = append(b.reads, id)
+	return nil, fmt.Errorf("prefetch failures are ignored")
+}
+
+func (b *prefetchBackend) GetIndividualSecret(path, secret string, annotations map[string]string) (interface{}, error) {
+	return nil, fmt.Errorf("prefetch is expected to read whole states")
+}
+
+func TestPrefetch(t *testing.T) {
+	manifests := []unstructured.Unstructured{
+		{
+			Object: map[string]interface{}{
+				"kind": "ConfigMap",
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{
+						types.ATPPathAnnotation:      "network@staging",
+						types.ATPWorkspaceAnnotation: "production",
+					},
+				},
+				"data": map[string]interface{}{
+					"vpc_id":  "<terraform:vpc_id>",
+					"db_host": "host=<terraform:database#host> port=<terraform:database#port | base64encode>",
+					"list":    []interface{}{"<terraform:cache@staging#host>", "<terraform:database#host#v1>"},
+				},
+			},
+		},
+		{
+			Object: map[string]interface{}{
+				"kind": "Secret",
+				"data": map[string]interface{}{
+					"password": base64.StdEncoding.EncodeToString([]byte("<terraform:database#password>")),
+					"token":    "<terraform:tokens#api>",
+					"username": base64.StdEncoding.EncodeToString([]byte("<path:secret/data/database#username>")),
+				},
+			},
+		},
+		{
+			Object: map[string]interface{}{
+				"kind": "Secret",
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{
+						types.ATPKVVersionAnnotation: "1",
+					},
+				},
+				"stringData": map[string]interface{}{
+					"username": "<path:secret/data/database#username>",
+				},
+			},
+		},
+		{
+			Object: map[string]interface{}{
+				"kind": "Secret",
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{
+						types.ATPIgnoreAnnotation: "true",
+					},
+				},
+				"stringData": map[string]interface{}{
+					"password": "<terraform:ignored#password>",
+				},
+			},
+		},
+	}
+
+	expected := []string{
+		"cache@staging#",
+		"database@#",
+		"database@production#",
+		"database@production#v1",
+		"network@staging#",
+		"tokens@#",
+	}
+
+	// Vault secrets are only read by backends serving Vault
+	backend := &prefetchBackend{}
+	Prefetch(manifests, backend, 3)
+	sort.Strings(backend.reads)
+	if !reflect.DeepEqual(backend.reads, expected) {
+		t.Fatalf("expected states %v to be prefetched but got %v", expected, backend.reads)
+	}
+
+	expected = append(expected, "vault://secret/data/database@#", "vault://secret/data/database@# kv1")
+	backend = &prefetchBackend{vault: true}
+	Prefetch(manifests, backend, 3)
+	sort.Strings(backend.reads)
+	if !reflect.DeepEqual(backend.reads, expected) {
+		t.Fatalf("expected states %v to be prefetched but got %v", expected, backend.reads)
+	}
+}
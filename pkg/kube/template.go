@@ -33,7 +33,8 @@ func NewTemplate(template unstructured.Unstructured, backend types.Backend) (*Te
 	var err error
 	var data map[string]interface{}
 	if path != "" {
-		data, err = backend.GetSecrets(path, annotations)
+		statePath, stateAnnotations := workspacePath(path, annotations)
+		data, err = backend.GetSecrets(statePath, stateAnnotations)
 		if err != nil {
 			return nil, err
 		}
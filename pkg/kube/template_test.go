@@ -2,9 +2,11 @@ package kube
 
 import (
 	"io/ioutil"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/KazanExpress/argocd-terraform-plugin/pkg/backends"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/helpers"
 	"github.com/KazanExpress/argocd-terraform-plugin/pkg/types"
 
@@ -311,6 +313,54 @@ func TestNewTemplate(t *testing.T) {
 	})
 }
 
+func TestReplace_InlineLineage(t *testing.T) {
+	root := t.TempDir()
+	state := []byte(`{"version": 4, "serial": 7, "lineage": "overwritten", "outputs": {"vpc_id": {"value": "vpc-123"}}}`)
+	if err := ioutil.WriteFile(filepath.Join(root, "network.tfstate"), state, 0644); err != nil {
+		t.Fatal(err)
+	}
+	backend := backends.NewLocalBackend(root)
+
+	testCases := []struct {
+		name        string
+		annotations map[string]interface{}
+		valid       bool
+	}{
+		{"matching lineage", map[string]interface{}{types.ATPLineageAnnotation: "overwritten"}, true},
+		{"mismatched lineage", map[string]interface{}{types.ATPLineageAnnotation: "expected"}, false},
+		{"newer min serial", map[string]interface{}{types.ATPMinSerialAnnotation: "8"}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Only inline placeholders, no atp.kubernetes.io/path annotation
+			template, err := NewTemplate(unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"kind":       "ConfigMap",
+					"apiVersion": "v1",
+					"metadata": map[string]interface{}{
+						"name":        "network",
+						"annotations": tc.annotations,
+					},
+					"data": map[string]interface{}{
+						"vpc_id": "<terraform:network.tfstate#vpc_id>",
+					},
+				},
+			}, backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = template.Replace()
+			if tc.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tc.valid && err == nil {
+				t.Fatal("expected the generation to fail")
+			}
+		})
+	}
+}
+
 func TestToYAML_Deployment(t *testing.T) {
 	d := Template{
 		Resource{
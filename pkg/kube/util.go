@@ -23,9 +23,25 @@ func (e *missingKeyError) Error() string {
 	return e.s
 }
 
-var genericPlaceholder, _ = regexp.Compile(`(?mU)<terraform:(.*)>`)
-var specificPathPlaceholder, _ = regexp.Compile(`(?mU)<terraform:([^#]+)#([^#]+)(?:#([^#]+))?>`)
-var indivPlaceholderSyntax, _ = regexp.Compile(`(?mU)(?P<path>[^#]+?)#(?P<key>[^#]+?)??`)
+var genericPlaceholder, _ = regexp.Compile(`(?mU)<(?:terraform|path):(.*)>`)
+var specificPathPlaceholder, _ = regexp.Compile(`(?mU)<(?:terraform|path):([^#]+)#([^#]+)(?:#([^#]+))?>`)
+var indivPlaceholderSyntax, _ = regexp.Compile(`(?mU)(?P<path>[^#]+?)#(?P<key>[^#]+?)??(?:#(?P<version>[^#]+?))??`)
+var workspaceSuffix, _ = regexp.Compile(`^(.+)@([\w-]+)$`)
+
+// vaultPlaceholderPrefix starts the Vault placeholders of argocd-vault-plugin, like `<path:secret/data/database#password>`
+const vaultPlaceholderPrefix = "path:"
+
+// vaultPlaceholders tells whether `backend` reads Vault placeholders through the vault:// scheme.
+// Otherwise they are kept as they are for argocd-vault-plugin running after this plugin
+func vaultPlaceholders(backend types.Backend) bool {
+	router, ok := backend.(interface{ Serves(string) bool })
+	return ok && router.Serves(types.VaultScheme)
+}
+
+// keptPlaceholder tells whether the placeholder `match` is left as it is
+func keptPlaceholder(match string, vault bool) bool {
+	return !vault && strings.HasPrefix(match, "<"+vaultPlaceholderPrefix)
+}
 
 // replaceInner recurses through the given map and replaces the placeholders by calling `replacerFunc`
 // with the key, value, and map of keys to replacement values
@@ -114,26 +130,21 @@ func genericReplacement(key, value string, resource Resource) (_ interface{}, er
 		placeholderRegex = genericPlaceholder
 	}
 
+	vault := vaultPlaceholders(resource.Backend)
 	res := placeholderRegex.ReplaceAllFunc([]byte(value), func(match []byte) []byte {
-		placeholder := strings.Trim(string(match), "<>")
-		placeholder = strings.TrimPrefix(placeholder, "terraform:")
-
-		// Split modifiers from placeholder
-		pipelineFields := strings.Split(placeholder, "|")
-		placeholder = strings.Trim(pipelineFields[0], " ")
+		if keptPlaceholder(string(match), vault) {
+			return match
+		}
+		placeholder, pipelineFields := splitPlaceholder(string(match))
 
 		utils.VerboseToStdErr("found placeholder %s with modifiers %s", placeholder, pipelineFields[1:])
 
 		var secretValue interface{}
 		var secretErr error
 		// Check to see if should call out to get individual secret (inline-path in placeholder)
-		if indivPlaceholderSyntax.Match([]byte(placeholder)) {
-			indivSecretMatches := indivPlaceholderSyntax.FindStringSubmatch(placeholder)
-			path := indivSecretMatches[indivPlaceholderSyntax.SubexpIndex("path")]
-			key := indivSecretMatches[indivPlaceholderSyntax.SubexpIndex("key")]
-
+		if path, key, annotations, ok := inlinePathState(placeholder, resource.Annotations); ok {
 			utils.VerboseToStdErr("calling GetIndividualSecret for secret %s from path %s ", key, path)
-			secretValue, secretErr = resource.Backend.GetIndividualSecret(path, strings.TrimSpace(key), resource.Annotations)
+			secretValue, secretErr = resource.Backend.GetIndividualSecret(path, key, annotations)
 			if secretErr != nil {
 				err = append(err, secretErr)
 				return match
@@ -142,6 +153,17 @@ func genericReplacement(key, value string, resource Resource) (_ interface{}, er
 			secretValue = resource.Data[placeholder]
 		}
 
+		// Sensitive values may only be rendered into Secrets, unless the manifest explicitly allows them
+		if sensitive, ok := secretValue.(types.SensitiveValue); ok {
+			allowSensitive, _ := strconv.ParseBool(resource.Annotations[types.ATPAllowSensitiveAnnotation])
+			if resource.Kind != "Secret" && !allowSensitive {
+				e := fmt.Errorf("sensitive value for placeholder %s in string %s: %s can only be used in Secret resources, unless %s is set", placeholder, key, value, types.ATPAllowSensitiveAnnotation)
+				err = append(err, e)
+				return match
+			}
+			secretValue = sensitive.Value
+		}
+
 		if secretValue != nil {
 			// Process modifiers
 			for _, stmt := range pipelineFields[1:] {
@@ -171,6 +193,10 @@ func genericReplacement(key, value string, resource Resource) (_ interface{}, er
 				}
 			default:
 				{
+					// Placeholders embedded in a string render the value as a string, e.g. `host:<port>`
+					if strings.TrimSpace(value) != string(match) {
+						return []byte(stringify(secretValue))
+					}
 					nonStringReplacement = secretValue
 					return match
 				}
@@ -220,12 +246,29 @@ func secretReplacement(key, value string, resource Resource) (interface{}, []err
 	return genericReplacement(key, value, resource)
 }
 
+// stringify renders `input` as a string. Numbers never use an exponent, lists and maps render as JSON
 func stringify(input interface{}) string {
 	switch input.(type) {
+	case nil:
+		{
+			return ""
+		}
+	case string:
+		{
+			return input.(string)
+		}
 	case int:
 		{
 			return strconv.Itoa(input.(int))
 		}
+	case int64:
+		{
+			return strconv.FormatInt(input.(int64), 10)
+		}
+	case float64:
+		{
+			return strconv.FormatFloat(input.(float64), 'f', -1, 64)
+		}
 	case bool:
 		{
 			return strconv.FormatBool(input.(bool))
@@ -240,7 +283,11 @@ func stringify(input interface{}) string {
 		}
 	default:
 		{
-			return input.(string)
+			data, err := json.Marshal(input)
+			if err != nil {
+				return fmt.Sprint(input)
+			}
+			return string(data)
 		}
 	}
 }
@@ -251,6 +298,103 @@ func kubeResourceDecoder(data *map[string]interface{}) *k8yaml.YAMLToJSONDecoder
 	return decoder
 }
 
+// splitPlaceholder strips the `<terraform:...>` delimiters from `match` and splits it into the placeholder
+// and its modifiers. The returned fields hold the placeholder first, followed by the modifiers.
+// Vault `<path:...>` placeholders read their path through the vault:// scheme
+func splitPlaceholder(match string) (string, []string) {
+	placeholder := strings.Trim(match, "<>")
+	if strings.HasPrefix(placeholder, vaultPlaceholderPrefix) {
+		placeholder = types.VaultScheme + "://" + strings.TrimLeft(strings.TrimPrefix(placeholder, vaultPlaceholderPrefix), " /")
+	} else {
+		placeholder = strings.TrimPrefix(placeholder, "terraform:")
+	}
+
+	// Split modifiers from placeholder
+	pipelineFields := strings.Split(placeholder, "|")
+
+	return strings.Trim(pipelineFields[0], " "), pipelineFields
+}
+
+// inlinePathState parses an inline-path `placeholder` into the path and key it reads, along with the annotations
+// selecting the workspace and version of the state. It returns false for placeholders without an inline path
+func inlinePathState(placeholder string, annotations map[string]string) (string, string, map[string]string, bool) {
+	if !indivPlaceholderSyntax.MatchString(placeholder) {
+		return "", "", nil, false
+	}
+
+	indivSecretMatches := indivPlaceholderSyntax.FindStringSubmatch(placeholder)
+	path := indivSecretMatches[indivPlaceholderSyntax.SubexpIndex("path")]
+	key := indivSecretMatches[indivPlaceholderSyntax.SubexpIndex("key")]
+	version := indivSecretMatches[indivPlaceholderSyntax.SubexpIndex("version")]
+
+	path, stateAnnotations := workspacePath(path, annotations)
+	stateAnnotations = inlineAnnotations(stateAnnotations, path, strings.TrimSpace(version))
+
+	return path, strings.TrimSpace(key), stateAnnotations, true
+}
+
+// workspacePath splits the workspace from `path@workspace` and returns the path along with
+// `annotations` selecting that workspace. Paths without a workspace are returned as they are,
+// falling back to the workspace of the atp.kubernetes.io/workspace annotation
+func workspacePath(path string, annotations map[string]string) (string, map[string]string) {
+	matches := workspaceSuffix.FindStringSubmatch(path)
+	if matches == nil {
+		return path, annotations
+	}
+
+	selected := copyAnnotations(annotations)
+	selected[types.ATPWorkspaceAnnotation] = matches[2]
+
+	return matches[1], selected
+}
+
+// checkAnnotations check the state of the atp.kubernetes.io/path annotation, or the states of the inline-path
+// placeholders of manifests without one
+var checkAnnotations = []string{types.ATPLineageAnnotation, types.ATPMinSerialAnnotation}
+
+// inlineAnnotations returns `annotations` for the state at `path` of an inline-path placeholder, pinned to `version`
+// or to no version at all if it's empty. Inline-path placeholders pin their own state with a `#version` segment.
+// The lineage and serial annotations check the state of the atp.kubernetes.io/path annotation when it's set,
+// and the states of all inline-path placeholders otherwise, so they are never silently ignored.
+// Vault secrets aren't states, they are never checked
+func inlineAnnotations(annotations map[string]string, path, version string) map[string]string {
+	_, pathAnnotated := annotations[types.ATPPathAnnotation]
+	stripChecks := pathAnnotated || strings.HasPrefix(path, types.VaultScheme+"://")
+
+	stale := annotations[types.ATPVersionAnnotation] != version
+	for _, name := range checkAnnotations {
+		if _, ok := annotations[name]; ok && stripChecks {
+			stale = true
+		}
+	}
+	if !stale {
+		return annotations
+	}
+
+	selected := copyAnnotations(annotations)
+	if stripChecks {
+		for _, name := range checkAnnotations {
+			delete(selected, name)
+		}
+	}
+	if version == "" {
+		delete(selected, types.ATPVersionAnnotation)
+	} else {
+		selected[types.ATPVersionAnnotation] = version
+	}
+
+	return selected
+}
+
+func copyAnnotations(annotations map[string]string) map[string]string {
+	copied := make(map[string]string, len(annotations)+1)
+	for name, value := range annotations {
+		copied[name] = value
+	}
+
+	return copied
+}
+
 func secretNamespaceName(input string) (string, string) {
 	var secretNamespace, secretName string
 	nameFields := strings.Split(input, ":")
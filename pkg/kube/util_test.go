@@ -573,6 +573,30 @@ func TestStringify(t *testing.T) {
 			[]byte("bytes"),
 			"bytes",
 		},
+		{
+			float64(1234500000),
+			"1234500000",
+		},
+		{
+			0.25,
+			"0.25",
+		},
+		{
+			int64(9007199254740993),
+			"9007199254740993",
+		},
+		{
+			nil,
+			"",
+		},
+		{
+			[]interface{}{"a", json.Number("12345678901234567890")},
+			`["a",12345678901234567890]`,
+		},
+		{
+			map[string]interface{}{"port": json.Number("5432")},
+			`{"port":5432}`,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -611,3 +635,322 @@ func TestSecretNamespaceName(t *testing.T) {
 		}
 	}
 }
+
+func TestWorkspacePath(t *testing.T) {
+	annotations := map[string]string{
+		types.ATPWorkspaceAnnotation: "annotated",
+	}
+	testCases := []struct {
+		input             string
+		expectedPath      string
+		expectedWorkspace string
+	}{
+		{
+			"path/to/state",
+			"path/to/state",
+			"annotated",
+		},
+		{
+			"path/to/state@staging",
+			"path/to/state",
+			"staging",
+		},
+		{
+			"s3://bucket/app.tfstate@prod_eu-1",
+			"s3://bucket/app.tfstate",
+			"prod_eu-1",
+		},
+		{
+			"https://user@example.com/state",
+			"https://user@example.com/state",
+			"annotated",
+		},
+	}
+
+	for _, tc := range testCases {
+		path, selected := workspacePath(tc.input, annotations)
+		if path != tc.expectedPath {
+			t.Errorf("expected path: %s, got: %s.", tc.expectedPath, path)
+		}
+		if selected[types.ATPWorkspaceAnnotation] != tc.expectedWorkspace {
+			t.Errorf("expected workspace: %s, got: %s.", tc.expectedWorkspace, selected[types.ATPWorkspaceAnnotation])
+		}
+	}
+
+	if annotations[types.ATPWorkspaceAnnotation] != "annotated" {
+		t.Error("expected the resource annotations to be left untouched")
+	}
+}
+
+// stateSelectionBackend records the path and annotations the last state was read with
+type stateSelectionBackend struct {
+	helpers.MockStateBackend
+	path        string
+	annotations map[string]string
+}
+
+func (b *stateSelectionBackend) Serves(scheme string) bool {
+	return scheme == types.VaultScheme
+}
+
+func (b *stateSelectionBackend) GetIndividualSecret(path, secret string, annotations map[string]string) (interface{}, error) {
+	b.path = path
+	b.annotations = annotations
+	return b.MockStateBackend.GetIndividualSecret(path, secret, annotations)
+}
+
+func TestGenericReplacement_workspaceAndVersion(t *testing.T) {
+	mv := stateSelectionBackend{}
+	mv.LoadData(map[string]interface{}{
+		"namespace": "default",
+	})
+
+	testCases := []struct {
+		placeholder       string
+		expectedPath      string
+		expectedWorkspace string
+		expectedVersion   string
+	}{
+		{
+			"<terraform:blah/blah#namespace>",
+			"blah/blah",
+			"annotated",
+			"",
+		},
+		{
+			"<terraform:blah/blah@staging#namespace#v1>",
+			"blah/blah",
+			"staging",
+			"v1",
+		},
+		{
+			"<terraform:blah/blah#namespace# v2 | base64encode>",
+			"blah/blah",
+			"annotated",
+			"v2",
+		},
+		{
+			"<path:secret/data/blah#namespace>",
+			"vault://secret/data/blah",
+			"annotated",
+			"",
+		},
+		{
+			"<path: secret/data/blah#namespace#3 | base64encode>",
+			"vault://secret/data/blah",
+			"annotated",
+			"3",
+		},
+	}
+
+	for _, tc := range testCases {
+		dummyResource := Resource{
+			TemplateData: map[string]interface{}{
+				"namespace": tc.placeholder,
+			},
+			Backend: &mv,
+			Annotations: map[string]string{
+				types.ATPPathAnnotation:      "annotated/path",
+				types.ATPWorkspaceAnnotation: "annotated",
+				types.ATPVersionAnnotation:   "annotated-path-version",
+				types.ATPLineageAnnotation:   "annotated-path-lineage",
+			},
+		}
+
+		replaceInner(&dummyResource, &dummyResource.TemplateData, genericReplacement)
+
+		if len(dummyResource.replacementErrors) != 0 {
+			t.Fatalf("expected 0 errors but got: %s", dummyResource.replacementErrors)
+		}
+		if mv.path != tc.expectedPath {
+			t.Errorf("expected path: %s, got: %s.", tc.expectedPath, mv.path)
+		}
+		if mv.annotations[types.ATPWorkspaceAnnotation] != tc.expectedWorkspace {
+			t.Errorf("expected workspace: %s, got: %s.", tc.expectedWorkspace, mv.annotations[types.ATPWorkspaceAnnotation])
+		}
+		if mv.annotations[types.ATPVersionAnnotation] != tc.expectedVersion {
+			t.Errorf("expected version: %s, got: %s.", tc.expectedVersion, mv.annotations[types.ATPVersionAnnotation])
+		}
+		if lineage, ok := mv.annotations[types.ATPLineageAnnotation]; ok {
+			t.Errorf("expected no lineage, got: %s.", lineage)
+		}
+	}
+}
+
+func TestGenericReplacement_inlineChecks(t *testing.T) {
+	mv := stateSelectionBackend{}
+	mv.LoadData(map[string]interface{}{
+		"namespace": "default",
+	})
+
+	// Without the path annotation the lineage and serial annotations check the inline states
+	testCases := []struct {
+		placeholder     string
+		expectedLineage string
+		expectedSerial  string
+	}{
+		{"<terraform:blah/blah#namespace>", "expected-lineage", "12"},
+		{"<terraform:blah/blah#namespace#v1>", "expected-lineage", "12"},
+		{"<path:secret/data/blah#namespace>", "", ""},
+	}
+
+	for _, tc := range testCases {
+		dummyResource := Resource{
+			TemplateData: map[string]interface{}{
+				"namespace": tc.placeholder,
+			},
+			Backend: &mv,
+			Annotations: map[string]string{
+				types.ATPLineageAnnotation:   "expected-lineage",
+				types.ATPMinSerialAnnotation: "12",
+			},
+		}
+
+		replaceInner(&dummyResource, &dummyResource.TemplateData, genericReplacement)
+
+		if len(dummyResource.replacementErrors) != 0 {
+			t.Fatalf("expected 0 errors but got: %s", dummyResource.replacementErrors)
+		}
+		if mv.annotations[types.ATPLineageAnnotation] != tc.expectedLineage {
+			t.Errorf("expected lineage: %q for %s, got: %q.", tc.expectedLineage, tc.placeholder, mv.annotations[types.ATPLineageAnnotation])
+		}
+		if mv.annotations[types.ATPMinSerialAnnotation] != tc.expectedSerial {
+			t.Errorf("expected min serial: %q for %s, got: %q.", tc.expectedSerial, tc.placeholder, mv.annotations[types.ATPMinSerialAnnotation])
+		}
+	}
+}
+
+func TestReplace_KeepVaultPlaceholders(t *testing.T) {
+	// Without Vault, placeholders of argocd-vault-plugin are kept for it to replace after this plugin
+	mv := helpers.MockStateBackend{}
+	mv.LoadData(map[string]interface{}{
+		"host": "db.internal",
+	})
+
+	testCases := []struct {
+		kind     string
+		data     map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			"ConfigMap",
+			map[string]interface{}{
+				"url":      "https://<terraform:state#host>/?password=<path:secret/data/database#password>",
+				"password": "<path: secret/data/database#password#2 | base64encode>",
+			},
+			map[string]interface{}{
+				"url":      "https://db.internal/?password=<path:secret/data/database#password>",
+				"password": "<path: secret/data/database#password#2 | base64encode>",
+			},
+		},
+		{
+			"Secret",
+			map[string]interface{}{
+				"password": base64.StdEncoding.EncodeToString([]byte("<path:secret/data/database#password>")),
+			},
+			map[string]interface{}{
+				"password": base64.StdEncoding.EncodeToString([]byte("<path:secret/data/database#password>")),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		template := Template{
+			Resource{
+				Kind:         tc.kind,
+				TemplateData: map[string]interface{}{"data": tc.data},
+				Backend:      &mv,
+				Annotations:  map[string]string{},
+			},
+		}
+		if err := template.Replace(); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(template.TemplateData["data"], tc.expected) {
+			t.Fatalf("expected %v but got %v", tc.expected, template.TemplateData["data"])
+		}
+	}
+}
+
+func TestGenericReplacement_sensitive(t *testing.T) {
+	mv := helpers.MockStateBackend{}
+	mv.LoadData(map[string]interface{}{
+		"password": types.SensitiveValue{Value: "s3cr3t"},
+	})
+
+	testCases := []struct {
+		kind        string
+		annotations map[string]string
+		allowed     bool
+	}{
+		{"ConfigMap", map[string]string{}, false},
+		{"Deployment", map[string]string{types.ATPAllowSensitiveAnnotation: "false"}, false},
+		{"Secret", map[string]string{}, true},
+		{"ConfigMap", map[string]string{types.ATPAllowSensitiveAnnotation: "true"}, true},
+	}
+
+	for _, tc := range testCases {
+		dummyResource := Resource{
+			Kind: tc.kind,
+			TemplateData: map[string]interface{}{
+				"password": "<terraform:state#password | base64encode>",
+			},
+			Backend:     &mv,
+			Annotations: tc.annotations,
+		}
+
+		replaceInner(&dummyResource, &dummyResource.TemplateData, genericReplacement)
+
+		if tc.allowed {
+			if len(dummyResource.replacementErrors) != 0 {
+				t.Fatalf("expected 0 errors for %s but got: %s", tc.kind, dummyResource.replacementErrors)
+			}
+			if dummyResource.TemplateData["password"] != "czNjcjN0" {
+				t.Fatalf("expected the sensitive value to be replaced in %s but got %v", tc.kind, dummyResource.TemplateData["password"])
+			}
+		} else {
+			if len(dummyResource.replacementErrors) != 1 {
+				t.Fatalf("expected 1 error for %s but got: %s", tc.kind, dummyResource.replacementErrors)
+			}
+			if dummyResource.TemplateData["password"] != "<terraform:state#password | base64encode>" {
+				t.Fatalf("expected the placeholder to be kept in %s but got %v", tc.kind, dummyResource.TemplateData["password"])
+			}
+		}
+	}
+}
+
+func TestGenericReplacement_embeddedNonString(t *testing.T) {
+	dummyResource := Resource{
+		TemplateData: map[string]interface{}{
+			"port":    "<terraform:port>",
+			"address": "db.internal:<terraform:port>",
+			"flags":   "enabled=<terraform:enabled>, zones=<terraform:zones>",
+		},
+		Data: map[string]interface{}{
+			"port":    json.Number("5432"),
+			"enabled": true,
+			"zones":   []interface{}{"a", "b"},
+		},
+		Annotations: map[string]string{
+			(types.ATPPathAnnotation): "",
+		},
+	}
+
+	replaceInner(&dummyResource, &dummyResource.TemplateData, genericReplacement)
+
+	expected := Resource{
+		TemplateData: map[string]interface{}{
+			"port":    json.Number("5432"),
+			"address": "db.internal:5432",
+			"flags":   `enabled=true, zones=["a","b"]`,
+		},
+		Data: map[string]interface{}{
+			"port":    json.Number("5432"),
+			"enabled": true,
+			"zones":   []interface{}{"a", "b"},
+		},
+		replacementErrors: []error{},
+	}
+
+	assertSuccessfulReplacement(&dummyResource, &expected, t)
+}
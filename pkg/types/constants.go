@@ -5,20 +5,133 @@ const (
 	EnvArgoCDPrefix = "ARGOCD_ENV"
 
 	// Environment Variable Constants
-	EnvAtpBackend     = "ATP_BACKEND"
-	EnvAtpS3Bucket    = "ATP_S3_BUCKET"
-	EnvAtpS3Endpoint  = "ATP_S3_ENDPOINT"
-	EnvAtpS3AccessKey = "ATP_S3_ACCESS_KEY"
-	EnvAtpS3SecretKey = "ATP_S3_SECRET_KEY"
-	EnvAtpS3UseSSL    = "ATP_S3_USE_SSL"
+	EnvAtpBackend               = "ATP_BACKEND"
+	EnvAtpPrefetchWorkers       = "ATP_PREFETCH_WORKERS"
+	EnvAtpCacheDir              = "ATP_CACHE_DIR"
+	EnvAtpCacheTTL              = "ATP_CACHE_TTL"
+	EnvAtpS3Bucket              = "ATP_S3_BUCKET"
+	EnvAtpS3Endpoint            = "ATP_S3_ENDPOINT"
+	EnvAtpS3AccessKey           = "ATP_S3_ACCESS_KEY"
+	EnvAtpS3SecretKey           = "ATP_S3_SECRET_KEY"
+	EnvAtpS3UseSSL              = "ATP_S3_USE_SSL"
+	EnvAtpS3Region              = "ATP_S3_REGION"
+	EnvAtpS3BucketLookup        = "ATP_S3_BUCKET_LOOKUP"
+	EnvAtpS3CAFile              = "ATP_S3_CA_FILE"
+	EnvAtpS3Proxy               = "ATP_S3_PROXY"
+	EnvAtpS3CredentialsProvider = "ATP_S3_CREDENTIALS_PROVIDER"
+	EnvAtpS3CredentialsFile     = "ATP_S3_CREDENTIALS_FILE"
+	EnvAtpS3Profile             = "ATP_S3_PROFILE"
+	EnvAtpS3RoleARN             = "ATP_S3_ROLE_ARN"
+	EnvAtpS3WebIdentityToken    = "ATP_S3_WEB_IDENTITY_TOKEN_FILE"
+	EnvAtpS3STSEndpoint         = "ATP_S3_STS_ENDPOINT"
+	EnvAtpS3STSRegion           = "ATP_S3_STS_REGION"
+	EnvAtpS3AssumeRoleARN       = "ATP_S3_ASSUME_ROLE_ARN"
+	EnvAtpS3AssumeRoleSession   = "ATP_S3_ASSUME_ROLE_SESSION_NAME"
+	EnvAtpS3AssumeRoleExternal  = "ATP_S3_ASSUME_ROLE_EXTERNAL_ID"
+	EnvAtpS3VaultPath           = "ATP_S3_VAULT_PATH"
+	EnvAtpS3WorkspaceKeyPrefix  = "ATP_S3_WORKSPACE_KEY_PREFIX"
+	EnvAtpS3SSECustomerKey      = "ATP_S3_SSE_CUSTOMER_KEY"
+	EnvAtpS3SSECustomerKeyFile  = "ATP_S3_SSE_CUSTOMER_KEY_FILE"
+	EnvAtpStatePassphrase       = "ATP_STATE_PASSPHRASE"
+	EnvAtpStatePassphraseFile   = "ATP_STATE_PASSPHRASE_FILE"
+	EnvAtpStateKey              = "ATP_STATE_KEY"
+	EnvAtpStateKeyFile          = "ATP_STATE_KEY_FILE"
+	EnvAtpLocalRoot             = "ATP_LOCAL_ROOT"
+	EnvAtpOutputsRoot           = "ATP_OUTPUTS_ROOT"
+	EnvAtpHTTPAddress           = "ATP_HTTP_ADDRESS"
+	EnvAtpHTTPUsername          = "ATP_HTTP_USERNAME"
+	EnvAtpHTTPPassword          = "ATP_HTTP_PASSWORD"
+	EnvAtpHTTPHeaders           = "ATP_HTTP_HEADERS"
+	EnvAtpHTTPCAFile            = "ATP_HTTP_CA_FILE"
+	EnvAtpGCSBucket             = "ATP_GCS_BUCKET"
+	EnvAtpGCSCredentials        = "ATP_GCS_CREDENTIALS"
+	EnvAtpGCSEndpoint           = "ATP_GCS_ENDPOINT"
+	EnvAtpAzureRMStorageAccount = "ATP_AZURERM_STORAGE_ACCOUNT"
+	EnvAtpAzureRMContainer      = "ATP_AZURERM_CONTAINER"
+	EnvAtpAzureRMAccessKey      = "ATP_AZURERM_ACCESS_KEY"
+	EnvAtpAzureRMSASToken       = "ATP_AZURERM_SAS_TOKEN"
+	EnvAtpAzureRMEndpoint       = "ATP_AZURERM_ENDPOINT"
+	EnvAtpConsulAddress         = "ATP_CONSUL_ADDRESS"
+	EnvAtpConsulToken           = "ATP_CONSUL_TOKEN"
+	EnvAtpConsulDatacenter      = "ATP_CONSUL_DATACENTER"
+	EnvAtpConsulCAFile          = "ATP_CONSUL_CA_FILE"
+	EnvAtpConsulCertFile        = "ATP_CONSUL_CERT_FILE"
+	EnvAtpConsulKeyFile         = "ATP_CONSUL_KEY_FILE"
+	EnvAtpPGConnStr             = "ATP_PG_CONN_STR"
+	EnvAtpTFEAddress            = "ATP_TFE_ADDRESS"
+	EnvAtpTFEToken              = "ATP_TFE_TOKEN"
+	EnvAtpTFEOrganization       = "ATP_TFE_ORGANIZATION"
+	EnvAtpAuthType              = "ATP_AUTH_TYPE"
+	EnvAtpGithubToken           = "ATP_GITHUB_TOKEN"
+	EnvAtpRoleID                = "ATP_ROLE_ID"
+	EnvAtpSecretID              = "ATP_SECRET_ID"
+	EnvAtpUsername              = "ATP_USERNAME"
+	EnvAtpPassword              = "ATP_PASSWORD"
+	EnvAtpMountPath             = "ATP_MOUNT_PATH"
+	EnvAtpK8sMountPath          = "ATP_K8S_MOUNT_PATH"
+	EnvAtpK8sRole               = "ATP_K8S_ROLE"
+	EnvAtpK8sTokenPath          = "ATP_K8S_TOKEN_PATH"
+	EnvAtpKVVersion             = "ATP_KV_VERSION"
+	EnvAtpVaultPlaceholders     = "ATP_VAULT_PLACEHOLDERS"
+
+	// Azure workload identity webhook Environment Variables
+	EnvAzureAuthorityHost      = "AZURE_AUTHORITY_HOST"
+	EnvAzureTenantID           = "AZURE_TENANT_ID"
+	EnvAzureClientID           = "AZURE_CLIENT_ID"
+	EnvAzureFederatedTokenFile = "AZURE_FEDERATED_TOKEN_FILE"
+
+	// EKS pod identity webhook (IRSA) Environment Variables
+	EnvAWSRoleARN              = "AWS_ROLE_ARN"
+	EnvAWSWebIdentityTokenFile = "AWS_WEB_IDENTITY_TOKEN_FILE"
 
 	// Backend and Auth Constants
-	S3Backend = "s3"
+	S3Backend         = "s3"
+	LocalBackend      = "local"
+	HTTPBackend       = "http"
+	GCSBackend        = "gcs"
+	AzureRMBackend    = "azurerm"
+	ConsulBackend     = "consul"
+	PGBackend         = "pg"
+	KubernetesBackend = "kubernetes"
+	RemoteBackend     = "remote"
+	CloudBackend      = "cloud"
+	OutputsBackend    = "outputs"
+	ApproleAuth       = "approle"
+	GithubAuth        = "github"
+	K8sAuth           = "k8s"
+	UserPassAuth      = "userpass"
+	TokenAuth         = "token"
+
+	// S3 credentials providers
+	S3CredentialsStatic      = "static"
+	S3CredentialsEnv         = "env"
+	S3CredentialsProfile     = "profile"
+	S3CredentialsMetadata    = "metadata"
+	S3CredentialsWebIdentity = "web-identity"
+	S3CredentialsChain       = "chain"
+	S3CredentialsVault       = "vault"
+
+	// S3 bucket lookup styles
+	S3BucketLookupAuto        = "auto"
+	S3BucketLookupPath        = "path"
+	S3BucketLookupVirtualHost = "virtual-host"
+
+	// State path schemes, besides the backend names
+	FileScheme  = "file"
+	HTTPScheme  = "http"
+	HTTPSScheme = "https"
+	VaultScheme = "vault"
 
 	// Supported annotations
-	ATPPathAnnotation          = "atp.kubernetes.io/path"
-	ATPIgnoreAnnotation        = "atp.kubernetes.io/ignore"
-	ATPRemoveMissingAnnotation = "atp.kubernetes.io/remove-missing"
+	ATPPathAnnotation           = "atp.kubernetes.io/path"
+	ATPIgnoreAnnotation         = "atp.kubernetes.io/ignore"
+	ATPRemoveMissingAnnotation  = "atp.kubernetes.io/remove-missing"
+	ATPWorkspaceAnnotation      = "atp.kubernetes.io/workspace"
+	ATPVersionAnnotation        = "atp.kubernetes.io/version"
+	ATPAllowSensitiveAnnotation = "atp.kubernetes.io/allow-sensitive"
+	ATPLineageAnnotation        = "atp.kubernetes.io/lineage"
+	ATPMinSerialAnnotation      = "atp.kubernetes.io/min-serial"
+	ATPKVVersionAnnotation      = "atp.kubernetes.io/kv-version"
 
 	// Kube Constants
 	ArgoCDNamespace = "argocd"
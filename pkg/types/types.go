@@ -17,6 +17,11 @@ type Backend interface {
 	GetIndividualSecret(path, secret string, annotations map[string]string) (interface{}, error)
 }
 
+// SensitiveValue wraps values the backend marks as sensitive, e.g. outputs with `sensitive = true`
+type SensitiveValue struct {
+	Value interface{}
+}
+
 // AuthType is and interface for the supported authentication methods
 type AuthType interface {
 	Authenticate(*api.Client) error
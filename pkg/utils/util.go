@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -109,6 +110,61 @@ func DefaultHttpClient() *http.Client {
 	return httpClient
 }
 
+// HttpClientWithCA returns the default http client trusting the PEM encoded certificates in `caFile`
+// in addition to the system pool. An empty `caFile` returns the default http client
+func HttpClientWithCA(caFile string) (*http.Client, error) {
+	httpClient := DefaultHttpClient()
+	if caFile == "" {
+		return httpClient, nil
+	}
+
+	pool, err := CertPoolWithCA(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient.Transport.(*http.Transport).TLSClientConfig.RootCAs = pool
+	return httpClient, nil
+}
+
+// CertPoolWithCA returns the system pool with the PEM encoded certificates in `caFile` added
+func CertPoolWithCA(caFile string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read CA file %s: %s", caFile, err.Error())
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("Could not parse any certificate from CA file %s", caFile)
+	}
+
+	return pool, nil
+}
+
+// HttpClientWithClientCert returns an http client like HttpClientWithCA that additionally presents the
+// PEM encoded client certificate in `certFile` and `keyFile`. Empty files present no client certificate
+func HttpClientWithClientCert(caFile, certFile, keyFile string) (*http.Client, error) {
+	httpClient, err := HttpClientWithCA(caFile)
+	if err != nil {
+		return nil, err
+	}
+	if certFile == "" && keyFile == "" {
+		return httpClient, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Could not load client certificate %s: %s", certFile, err.Error())
+	}
+
+	httpClient.Transport.(*http.Transport).TLSClientConfig.Certificates = []tls.Certificate{cert}
+	return httpClient, nil
+}
+
 func VerboseToStdErr(format string, message ...interface{}) {
 	if viper.GetBool("verboseOutput") {
 		log.Printf(fmt.Sprintf("%s\n", format), message...)
@@ -3,9 +3,11 @@ package utils_test
 import (
 	"crypto/tls"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -126,3 +128,62 @@ func TestDefaultHTTPClient(t *testing.T) {
 		t.Errorf("expected: %v, got: %v.", expectedClient, client)
 	}
 }
+
+func TestHttpClientWithCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPem, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("trusts the given CA", func(t *testing.T) {
+		client, err := utils.HttpClientWithCA(caFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	})
+
+	t.Run("rejects unknown CA", func(t *testing.T) {
+		client, err := utils.HttpClientWithCA("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Get(server.URL); err == nil {
+			t.Fatal("expected a certificate error")
+		}
+	})
+
+	t.Run("fails on invalid CA file", func(t *testing.T) {
+		invalid := filepath.Join(t.TempDir(), "invalid.pem")
+		if err := ioutil.WriteFile(invalid, []byte("not a certificate"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := utils.HttpClientWithCA(invalid); err == nil {
+			t.Fatal("expected an error for an invalid CA file")
+		}
+	})
+}
+
+func TestHttpClientWithClientCert(t *testing.T) {
+	client, err := utils.HttpClientWithClientCert("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.Transport.(*http.Transport).TLSClientConfig.Certificates) != 0 {
+		t.Fatal("expected no client certificate")
+	}
+
+	if _, err := utils.HttpClientWithClientCert("", "/does/not/exist.crt", "/does/not/exist.key"); err == nil {
+		t.Fatal("expected an error for a missing client certificate")
+	}
+}